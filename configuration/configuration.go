@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"paper/purgatory/service"
 	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -25,6 +27,18 @@ type Files struct {
 	Path string
 }
 
+type Catalog struct {
+	Url string
+}
+
+type Thumbnails struct {
+	Sizes []int
+}
+
+type Ingest struct {
+	Workers int
+}
+
 func (postgres *Postgres) Dsn() string {
 	return fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%d",
@@ -37,9 +51,12 @@ func (postgres *Postgres) Dsn() string {
 }
 
 type Config struct {
-	Postgres Postgres
-	Sign     Sign
-	Files    Files
+	Postgres   Postgres
+	Sign       Sign
+	Files      Files
+	Catalog    Catalog
+	Thumbnails Thumbnails
+	Ingest     Ingest
 }
 
 func LoadConfig() *Config {
@@ -57,10 +74,20 @@ func LoadConfig() *Config {
 
 	enrichPostgresConfig(config)
 	enrichFilesConfig(config)
+	enrichCatalogConfig(config)
+	enrichThumbnailsConfig(config)
+	enrichIngestConfig(config)
 
 	return config
 }
 
+func enrichCatalogConfig(config *Config) {
+	value, isPresent := os.LookupEnv("CATALOG_URL")
+	if isPresent {
+		config.Catalog.Url = value
+	}
+}
+
 func enrichFilesConfig(config *Config) {
 	value, isPresent := os.LookupEnv("FILES_PATH")
 	if isPresent {
@@ -68,6 +95,38 @@ func enrichFilesConfig(config *Config) {
 	}
 }
 
+func enrichThumbnailsConfig(config *Config) {
+	value, isPresent := os.LookupEnv("THUMBNAIL_SIZES")
+	if isPresent {
+		var sizes []int
+		for _, item := range strings.Split(value, ",") {
+			size, err := strconv.Atoi(strings.TrimSpace(item))
+			if err == nil && size > 0 {
+				sizes = append(sizes, size)
+			}
+		}
+		config.Thumbnails.Sizes = sizes
+	}
+
+	if len(config.Thumbnails.Sizes) == 0 {
+		config.Thumbnails.Sizes = service.DefaultThumbnailSizes
+	}
+}
+
+func enrichIngestConfig(config *Config) {
+	value, isPresent := os.LookupEnv("INGEST_WORKERS")
+	if isPresent {
+		workers, err := strconv.Atoi(value)
+		if err == nil {
+			config.Ingest.Workers = workers
+		}
+	}
+
+	if config.Ingest.Workers <= 0 {
+		config.Ingest.Workers = 2
+	}
+}
+
 func enrichPostgresConfig(config *Config) {
 	value, isPresent := os.LookupEnv("POSTGRES_HOST")
 
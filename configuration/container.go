@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"paper/purgatory/controller"
+	"paper/purgatory/model"
 	"paper/purgatory/service"
 
 	"gorm.io/driver/postgres"
@@ -13,18 +14,25 @@ import (
 type Container struct {
 	Database            *gorm.DB
 	PurgatoryService    service.PurgatoryService
+	JobService          service.JobService
 	PurgatoryController controller.PurgatoryController
+	JobController       controller.JobController
 }
 
 func InitContainer(config *Config) Container {
 	database := initDatabase(config.Postgres)
-	purgatoryService := service.Init(database, config.Files.Path)
-	purgatoryController := controller.Init(purgatoryService)
+	catalogClient := service.InitCatalogClient(config.Catalog.Url)
+	purgatoryService := service.Init(database, config.Files.Path, catalogClient, config.Thumbnails.Sizes)
+	jobService := service.InitJobService(database, purgatoryService, config.Files.Path, config.Ingest.Workers)
+	purgatoryController := controller.Init(purgatoryService, jobService)
+	jobController := controller.InitJobController(jobService)
 
 	return Container{
 		Database:            database,
 		PurgatoryService:    purgatoryService,
+		JobService:          jobService,
 		PurgatoryController: purgatoryController,
+		JobController:       jobController,
 	}
 }
 
@@ -35,5 +43,12 @@ func initDatabase(config Postgres) *gorm.DB {
 		fmt.Println("Failed to connect to postgres:", err)
 		os.Exit(1)
 	}
+
+	err = database.AutoMigrate(&model.PurgatoryItem{}, &model.PageHash{}, &model.Rejection{}, &model.Job{})
+	if err != nil {
+		fmt.Println("Failed to migrate database schema:", err)
+		os.Exit(1)
+	}
+
 	return database
 }
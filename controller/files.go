@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"paper/purgatory/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveFile streams an extracted file, leaving conditional and range requests to http.ServeContent
+func serveFile(ctx *gin.Context, path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Server error while reading file"})
+		return
+	}
+	defer utils.HandleClose(file.Close)
+
+	stat, err := file.Stat()
+	if err != nil {
+		fmt.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Server error while reading file"})
+		return
+	}
+
+	// Extensions of extracted pages can't be trusted, so the type is sniffed from the content
+	header := make([]byte, 512)
+	read, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		fmt.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Server error while reading file"})
+		return
+	}
+
+	ctx.Header("Content-Type", http.DetectContentType(header[:read]))
+	ctx.Header("ETag", fmt.Sprintf(`"%x-%x"`, stat.Size(), stat.ModTime().UnixNano()))
+	ctx.Header("Cache-Control", "private, no-cache")
+
+	http.ServeContent(ctx.Writer, ctx.Request, stat.Name(), stat.ModTime(), file)
+}
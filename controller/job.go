@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"net/http"
+	"paper/purgatory/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type jobController struct {
+	service service.JobService
+}
+
+type JobController interface {
+	Get(ctx *gin.Context)
+}
+
+func InitJobController(service service.JobService) JobController {
+	return &jobController{service: service}
+}
+
+func (c *jobController) Get(ctx *gin.Context) {
+	job, err := c.service.Get(ctx.Param("id"))
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, job)
+}
@@ -1,62 +1,166 @@
 package controller
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"paper/purgatory/dto"
+	"paper/purgatory/model"
 	"paper/purgatory/service"
-	"paper/purgatory/utils"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 type controller struct {
 	service service.PurgatoryService
+	jobs    service.JobService
 }
 
 type PurgatoryController interface {
 	Get(ctx *gin.Context)
 
+	GetOne(ctx *gin.Context)
+
+	GetPage(ctx *gin.Context)
+
+	GetCover(ctx *gin.Context)
+
 	UploadFile(ctx *gin.Context)
 
 	AddMeta(ctx *gin.Context)
+
+	Update(ctx *gin.Context)
+
+	Patch(ctx *gin.Context)
+
+	Approve(ctx *gin.Context)
+
+	Reject(ctx *gin.Context)
+
+	GetDuplicates(ctx *gin.Context)
+
+	GetVisualDuplicates(ctx *gin.Context)
+
+	Delete(ctx *gin.Context)
 }
 
-func Init(service service.PurgatoryService) PurgatoryController {
-	return &controller{service: service}
+func Init(service service.PurgatoryService, jobs service.JobService) PurgatoryController {
+	return &controller{service: service, jobs: jobs}
 }
 
 func (c *controller) Get(ctx *gin.Context) {
-	items := c.service.GetAll()
-	ctx.JSON(http.StatusOK, items)
+	var filter dto.PurgatoryFilter
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := c.service.GetAll(filter)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
 }
 
-func (c *controller) UploadFile(ctx *gin.Context) {
-	file, err := ctx.FormFile("file")
+func (c *controller) GetOne(ctx *gin.Context) {
+	id, ok := parseId(ctx)
+	if !ok {
+		return
+	}
+
+	details, err := c.service.Get(id)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "File is not presented"})
+		handleError(ctx, err)
+		return
+	}
+
+	ctx.Header("ETag", versionTag(details.Version))
+	ctx.JSON(http.StatusOK, details)
+}
+
+func (c *controller) GetPage(ctx *gin.Context) {
+	id, ok := parseId(ctx)
+	if !ok {
 		return
 	}
 
-	dest, destPath, err := c.service.UploadTempFile(file)
+	index, err := strconv.Atoi(ctx.Param("index"))
 	if err != nil {
-		fmt.Println(err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Server error while upload file"})
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page index"})
+		return
+	}
+
+	path, err := c.service.GetPagePath(id, index)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+
+	serveFile(ctx, path)
+}
+
+func (c *controller) GetCover(ctx *gin.Context) {
+	id, ok := parseId(ctx)
+	if !ok {
+		return
+	}
+
+	size, err := strconv.Atoi(ctx.DefaultQuery("size", "0"))
+	if err != nil || size < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cover size"})
+		return
+	}
+
+	path, err := c.service.GetCoverPath(id, size)
+	if err != nil {
+		handleError(ctx, err)
 		return
 	}
 
-	defer utils.HandleRemove(os.Remove, destPath)
-	defer utils.HandleClose(dest.Close)
+	serveFile(ctx, path)
+}
 
-	err = c.service.Save(dest, file.Filename)
+func (c *controller) UploadFile(ctx *gin.Context) {
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "File is not presented"})
+		return
+	}
+
+	// Either a single archive in "file", or loose page images in repeated "files" fields
+	var job *model.Job
+	if files := form.File["file"]; len(files) > 0 {
+		job, err = c.jobs.Submit(files[0])
+	} else if pages := form.File["files"]; len(pages) > 0 {
+		order := ctx.DefaultPostForm("order", service.BatchOrderUpload)
+		if order != service.BatchOrderUpload && order != service.BatchOrderNatural {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "order must be upload or natural"})
+			return
+		}
+		job, err = c.jobs.SubmitBatch(pages, strings.TrimSpace(ctx.PostForm("name")), order)
+	} else {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "File is not presented"})
+		return
+	}
+
+	if errors.Is(err, service.ErrUnsupportedFile) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		fmt.Println(err)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "File processing error"})
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Server error while upload file"})
 		return
 	}
 
-	ctx.Status(http.StatusOK)
+	ctx.Header("Location", "/jobs/"+job.ID)
+	ctx.JSON(http.StatusAccepted, job)
 }
 
 func (c *controller) AddMeta(ctx *gin.Context) {
@@ -69,3 +173,198 @@ func (c *controller) AddMeta(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, item)
 }
+
+// Update replaces the whole meta of an item
+func (c *controller) Update(ctx *gin.Context) {
+	c.updateMeta(ctx, func(meta *model.ArchiveMeta, body []byte) error {
+		*meta = model.ArchiveMeta{}
+		return decodeStrict(body, meta)
+	})
+}
+
+// Patch changes only the meta fields present in the request body
+func (c *controller) Patch(ctx *gin.Context) {
+	c.updateMeta(ctx, func(meta *model.ArchiveMeta, body []byte) error {
+		return decodeStrict(body, meta)
+	})
+}
+
+func (c *controller) updateMeta(ctx *gin.Context, apply func(meta *model.ArchiveMeta, body []byte) error) {
+	id, ok := parseId(ctx)
+	if !ok {
+		return
+	}
+
+	version, ok := parseIfMatch(ctx)
+	if !ok {
+		return
+	}
+
+	body, err := ctx.GetRawData()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	item, err := c.service.UpdateMeta(id, version, func(meta *model.ArchiveMeta) error {
+		return apply(meta, body)
+	})
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+
+	ctx.Header("ETag", versionTag(item.Version))
+	ctx.JSON(http.StatusOK, item)
+}
+
+func (c *controller) Approve(ctx *gin.Context) {
+	id, ok := parseId(ctx)
+	if !ok {
+		return
+	}
+
+	version, ok := parseIfMatch(ctx)
+	if !ok {
+		return
+	}
+
+	var request dto.ApproveRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	item, err := c.service.Approve(id, version, request, ctx.GetHeader("Authorization"))
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+
+	ctx.Header("ETag", versionTag(item.Version))
+	ctx.JSON(http.StatusOK, item)
+}
+
+func (c *controller) Reject(ctx *gin.Context) {
+	id, ok := parseId(ctx)
+	if !ok {
+		return
+	}
+
+	var request dto.RejectRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rejection, err := c.service.Reject(id, request.Reason, ctx.GetString("username"))
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, rejection)
+}
+
+func (c *controller) GetDuplicates(ctx *gin.Context) {
+	id, ok := parseId(ctx)
+	if !ok {
+		return
+	}
+
+	duplicates, err := c.service.FindDuplicates(id)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, duplicates)
+}
+
+func (c *controller) GetVisualDuplicates(ctx *gin.Context) {
+	var filter dto.VisualDuplicateFilter
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := c.service.FindVisualDuplicates(filter)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+func (c *controller) Delete(ctx *gin.Context) {
+	id, ok := parseId(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.service.Delete(id); err != nil {
+		handleError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func parseId(ctx *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item id"})
+		return 0, false
+	}
+
+	return id, true
+}
+
+// parseIfMatch reads the item version a change was based on, which every change must state
+func parseIfMatch(ctx *gin.Context) (int64, bool) {
+	ifMatch := ctx.GetHeader("If-Match")
+	if ifMatch == "" {
+		ctx.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header is required"})
+		return 0, false
+	}
+
+	version, err := parseVersionTag(ifMatch)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid If-Match header"})
+		return 0, false
+	}
+
+	return version, true
+}
+
+func decodeStrict(body []byte, target any) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(target)
+}
+
+func versionTag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+func parseVersionTag(tag string) (int64, error) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	return strconv.ParseInt(strings.Trim(tag, `"`), 10, 64)
+}
+
+func handleError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrItemNotFound), errors.Is(err, service.ErrPageNotFound), errors.Is(err, service.ErrJobNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrVersionMismatch):
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidSort), errors.Is(err, service.ErrInvalidMeta):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAlreadyApproved):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		fmt.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Server error while processing item"})
+	}
+}
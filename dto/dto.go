@@ -1,6 +1,11 @@
 package dto
 
-import "github.com/golang-sql/civil"
+import (
+	"paper/purgatory/model"
+	"time"
+
+	"github.com/golang-sql/civil"
+)
 
 type ApproveRequest struct {
 	SeriesUpdate SeriesUpdateRequest `json:"seriesUpdate"`
@@ -8,19 +13,98 @@ type ApproveRequest struct {
 }
 
 type SeriesUpdateRequest struct {
-	ID        int64  `json:"id"`
-	Title     string `json:"title"`
+	ID        int64  `json:"id" binding:"min=0"`
+	Title     string `json:"title" binding:"required_without=ID"`
 	Publisher string `json:"publisher"`
 }
 
 type IssueUpdateRequest struct {
-	Number          string     `json:"number"`
+	Number          string     `json:"number" binding:"required"`
 	Summary         string     `json:"summary"`
 	PublicationDate civil.Date `json:"publicationDate"`
-	PagesCount      int32      `json:"pagesCount"`
+	PagesCount      int32      `json:"pagesCount" binding:"min=0"`
 }
 
 type NewMeta struct {
 	Title  string `json:"title"`
 	Number string `json:"number"`
 }
+
+type RejectRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type PurgatoryFilter struct {
+	SeriesName   string    `form:"seriesName"`
+	Publisher    string    `form:"publisher"`
+	Number       string    `form:"number"`
+	Status       string    `form:"status" binding:"omitempty,oneof=pending approving approved all"`
+	UploadedFrom time.Time `form:"uploadedFrom" time_format:"2006-01-02"`
+	UploadedTo   time.Time `form:"uploadedTo" time_format:"2006-01-02"`
+	Overlapping  bool      `form:"overlapping"`
+	Sort         []string  `form:"sort"`
+	Page         int       `form:"page" binding:"min=0"`
+	Size         int       `form:"size" binding:"min=0,max=200"`
+}
+
+type PurgatoryPage struct {
+	Items []model.PurgatoryItem `json:"items"`
+	Total int64                 `json:"total"`
+	Page  int                   `json:"page"`
+	Size  int                   `json:"size"`
+}
+
+type PurgatoryItemDetails struct {
+	model.PurgatoryItem
+	Pages []PageFile `json:"pages"`
+}
+
+type PageFile struct {
+	Index      int    `json:"index"`
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	Format     string `json:"format"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Chapter    string `json:"chapter,omitempty"`
+	Type       string `json:"type,omitempty"`
+	DoublePage bool   `json:"doublePage,omitempty"`
+	Bookmark   string `json:"bookmark,omitempty"`
+}
+
+// VisualMatch is a pair of items that look like scans of the same issue
+type VisualMatch struct {
+	ItemID  int64 `json:"itemId"`
+	OtherID int64 `json:"otherId"`
+	// CoverDistance is the number of differing cover hash bits, -1 when a cover couldn't be hashed
+	CoverDistance  int     `json:"coverDistance"`
+	SimilarPages   int     `json:"similarPages"`
+	PageSimilarity float64 `json:"pageSimilarity"`
+}
+
+// VisualDuplicateGroup holds items that look alike, so reviewers can keep the best scan
+type VisualDuplicateGroup struct {
+	Items   []VisualDuplicateItem `json:"items"`
+	Matches []VisualMatch         `json:"matches"`
+}
+
+// VisualDuplicateItem sums an item up for telling look-alikes apart, its details are at GET /purgatory/:id
+type VisualDuplicateItem struct {
+	ID         int64     `json:"id"`
+	SeriesName string    `json:"seriesName"`
+	Number     string    `json:"number"`
+	PagesCount int       `json:"pagesCount"`
+	UploadedAt time.Time `json:"uploadedAt"`
+}
+
+type VisualDuplicateFilter struct {
+	Page int `form:"page" binding:"min=0"`
+	Size int `form:"size" binding:"min=0,max=200"`
+}
+
+type VisualDuplicatePage struct {
+	Items []VisualDuplicateGroup `json:"items"`
+	Total int64                  `json:"total"`
+	Page  int                    `json:"page"`
+	Size  int                    `json:"size"`
+}
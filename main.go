@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"os"
 	"paper/purgatory/configuration"
 
 	"github.com/gin-gonic/gin"
@@ -12,14 +13,18 @@ func main() {
 	config := configuration.LoadConfig()
 	container := configuration.InitContainer(config)
 
+	err := container.JobService.Start()
+	if err != nil {
+		fmt.Println("Failed to start ingestion workers:", err)
+		os.Exit(1)
+	}
+
 	router := gin.Default()
 	router.Use(configuration.CORSMiddleware())
 	router.Use(configuration.AuthMiddleware(config.Sign.Key, container.Database))
 	router.Use(gin.LoggerWithConfig(gin.LoggerConfig{SkipPaths: []string{"/actuator"}}))
 
-	router.GET("/purgatory", container.PurgatoryController.Get)
-	router.POST("/purgatory/meta", container.PurgatoryController.AddMeta)
-	router.POST("/purgatory", container.PurgatoryController.UploadFile)
+	registerRoutes(router, container)
 
 	actuatorGroup := router.Group("/actuator")
 	{
@@ -30,8 +35,26 @@ func main() {
 		})
 	}
 
-	err := router.Run(":8080")
+	err = router.Run(":8080")
 	if err != nil {
 		fmt.Println("Failed to start server:", err)
 	}
 }
+
+// registerRoutes maps the purgatory and job endpoints to their controllers
+func registerRoutes(router *gin.Engine, container configuration.Container) {
+	router.GET("/purgatory", container.PurgatoryController.Get)
+	router.GET("/purgatory/similar", container.PurgatoryController.GetVisualDuplicates)
+	router.GET("/purgatory/:id", container.PurgatoryController.GetOne)
+	router.GET("/purgatory/:id/pages/:index", container.PurgatoryController.GetPage)
+	router.GET("/purgatory/:id/cover", container.PurgatoryController.GetCover)
+	router.GET("/purgatory/:id/duplicates", container.PurgatoryController.GetDuplicates)
+	router.POST("/purgatory/meta", container.PurgatoryController.AddMeta)
+	router.POST("/purgatory", container.PurgatoryController.UploadFile)
+	router.GET("/jobs/:id", container.JobController.Get)
+	router.PUT("/purgatory/:id", container.PurgatoryController.Update)
+	router.PATCH("/purgatory/:id", container.PurgatoryController.Patch)
+	router.POST("/purgatory/:id/approve", container.PurgatoryController.Approve)
+	router.POST("/purgatory/:id/reject", container.PurgatoryController.Reject)
+	router.DELETE("/purgatory/:id", container.PurgatoryController.Delete)
+}
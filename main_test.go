@@ -1,18 +1,35 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"paper/purgatory/configuration"
+	"paper/purgatory/controller"
+	"paper/purgatory/dto"
+	"paper/purgatory/model"
+	"paper/purgatory/service"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang-sql/civil"
 	"github.com/stretchr/testify/suite"
 	"github.com/testcontainers/testcontainers-go"
 	postgresContainer "github.com/testcontainers/testcontainers-go/modules/postgres"
@@ -229,3 +246,1001 @@ func TestAuthMiddleware(t *testing.T) {
 	}
 	suite.Run(t, new(AuthMiddlewareTestSuite))
 }
+
+// stubCatalog records the imports it is asked for and fails them with err
+type stubCatalog struct {
+	mutex   sync.Mutex
+	err     error
+	imports []dto.ApproveRequest
+}
+
+func (c *stubCatalog) Import(request dto.ApproveRequest, pages []string, authorization string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	c.imports = append(c.imports, request)
+	return nil
+}
+
+func (c *stubCatalog) importCount() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.imports)
+}
+
+type PurgatoryTestSuite struct {
+	suite.Suite
+	pgContainer testcontainers.Container
+	db          *gorm.DB
+	filesPath   string
+	catalog     *stubCatalog
+	container   configuration.Container
+	router      *gin.Engine
+}
+
+// startPostgres runs a throwaway database for a suite
+func startPostgres(s *suite.Suite) (testcontainers.Container, *gorm.DB) {
+	ctx := context.Background()
+
+	pgContainer, err := postgresContainer.Run(
+		ctx,
+		"postgres:16-alpine",
+		postgresContainer.WithDatabase("testdb"),
+		postgresContainer.WithUsername("testuser"),
+		postgresContainer.WithPassword("testpassword"),
+		postgresContainer.BasicWaitStrategies(),
+	)
+
+	s.Require().NoError(err, "Failed to start PostgreSQL container")
+
+	mappedPort, err := pgContainer.MappedPort(ctx, "5432")
+	s.Require().NoError(err, "Failed to get mapped port")
+
+	host, err := pgContainer.Host(ctx)
+	s.Require().NoError(err, "Failed to get host")
+
+	dsn := fmt.Sprintf("host=%s user=testuser password=testpassword dbname=testdb port=%s sslmode=disable",
+		host, mappedPort.Port())
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	s.Require().NoError(err, "Failed to connect to database")
+
+	return pgContainer, db
+}
+
+func (s *PurgatoryTestSuite) SetupSuite() {
+	s.pgContainer, s.db = startPostgres(&s.Suite)
+
+	err := s.db.AutoMigrate(&model.PurgatoryItem{}, &model.PageHash{}, &model.Rejection{}, &model.Job{})
+	s.Require().NoError(err, "Failed to migrate database schema")
+
+	// Job workers outlive the test that started them, so every test shares the files directory they write to
+	s.filesPath, err = os.MkdirTemp("", "purgatory")
+	s.Require().NoError(err)
+}
+
+func (s *PurgatoryTestSuite) TearDownSuite() {
+	ctx := context.Background()
+	s.Require().NoError(s.pgContainer.Terminate(ctx), "Failed to terminate container")
+	s.Require().NoError(os.RemoveAll(s.filesPath))
+}
+
+func (s *PurgatoryTestSuite) SetupTest() {
+	s.Require().NoError(s.db.Exec("TRUNCATE TABLE purgatory, purgatory_page_hash, purgatory_rejection, purgatory_job RESTART IDENTITY").Error)
+
+	s.Require().NoError(os.RemoveAll(s.filesPath))
+	s.Require().NoError(os.MkdirAll(s.filesPath, 0755))
+	s.catalog = &stubCatalog{}
+
+	purgatoryService := service.Init(s.db, s.filesPath, s.catalog, []int{150})
+	jobService := service.InitJobService(s.db, purgatoryService, s.filesPath, 3)
+	s.container = configuration.Container{
+		Database:            s.db,
+		PurgatoryService:    purgatoryService,
+		JobService:          jobService,
+		PurgatoryController: controller.Init(purgatoryService, jobService),
+		JobController:       controller.InitJobController(jobService),
+	}
+
+	gin.SetMode(gin.TestMode)
+	s.router = gin.New()
+	registerRoutes(s.router, s.container)
+}
+
+func (s *PurgatoryTestSuite) itemPath(id int64) string {
+	return filepath.Join(s.filesPath, strconv.FormatInt(id, 10))
+}
+
+// createItem stores a pending item with the given number of extracted pages
+func (s *PurgatoryTestSuite) createItem(meta *model.ArchiveMeta, pagesCount int) model.PurgatoryItem {
+	item := model.PurgatoryItem{Meta: meta, Status: model.StatusPending}
+	s.Require().NoError(s.db.Create(&item).Error)
+
+	directory := s.itemPath(item.ID)
+	s.Require().NoError(os.MkdirAll(directory, 0755))
+
+	for index := range pagesCount {
+		var buffer bytes.Buffer
+		s.Require().NoError(png.Encode(&buffer, image.NewGray(image.Rect(0, 0, 20+index, 30))))
+
+		file := fmt.Sprintf("%03d.png", index)
+		s.Require().NoError(os.WriteFile(filepath.Join(directory, file), buffer.Bytes(), 0644))
+		item.Pages = append(item.Pages, model.Page{Index: index, File: file, Format: "png", Width: 20 + index, Height: 30})
+	}
+
+	s.Require().NoError(s.db.Model(&item).Select("Pages").Updates(&item).Error)
+	return item
+}
+
+// request sends a JSON body, if any, through the router
+func (s *PurgatoryTestSuite) request(method string, target string, body any, headers map[string]string) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		s.Require().NoError(err)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	request := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *PurgatoryTestSuite) reload(id int64) model.PurgatoryItem {
+	var item model.PurgatoryItem
+	s.Require().NoError(s.db.First(&item, id).Error)
+	return item
+}
+
+func (s *PurgatoryTestSuite) approve(id int64, version int64) *httptest.ResponseRecorder {
+	request := dto.ApproveRequest{
+		SeriesUpdate: dto.SeriesUpdateRequest{Title: "Saga"},
+		IssueUpdate:  dto.IssueUpdateRequest{Number: "1"},
+	}
+	return s.request(http.MethodPost, fmt.Sprintf("/purgatory/%d/approve", id), request,
+		map[string]string{"If-Match": fmt.Sprintf(`"%d"`, version)})
+}
+
+func (s *PurgatoryTestSuite) TestApprove() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "saga", Number: "01"}, 2)
+
+	response := s.approve(item.ID, 1)
+
+	s.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+	s.Assert().Equal(`"2"`, response.Header().Get("ETag"))
+	stored := s.reload(item.ID)
+	s.Assert().Equal(model.StatusApproved, stored.Status)
+	s.Assert().Equal(int64(2), stored.Version)
+	s.Assert().Equal("Saga", stored.Meta.SeriesName)
+	s.Assert().Equal(2, stored.Meta.PagesCount)
+	s.Assert().Equal(1, s.catalog.importCount())
+	s.Assert().NoDirExists(s.itemPath(item.ID))
+}
+
+func (s *PurgatoryTestSuite) TestApproveAppliesIssueUpdate() {
+	kept := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1", Summary: "Hazel is born."}, 1)
+	dated := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "2"}, 1)
+
+	// Without a summary in the request, the one read from the archive stays
+	s.Require().Equal(http.StatusOK, s.approve(kept.ID, 1).Code)
+	s.Assert().Equal("Hazel is born.", s.reload(kept.ID).Meta.Summary)
+
+	request := dto.ApproveRequest{
+		SeriesUpdate: dto.SeriesUpdateRequest{Title: "Saga"},
+		IssueUpdate:  dto.IssueUpdateRequest{Number: "2", Summary: "Marko and Alana flee.", PublicationDate: civil.Date{Year: 2012, Month: time.April, Day: 11}},
+	}
+	response := s.request(http.MethodPost, fmt.Sprintf("/purgatory/%d/approve", dated.ID), request, map[string]string{"If-Match": `"1"`})
+	s.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+
+	meta := s.reload(dated.ID).Meta
+	s.Assert().Equal("Marko and Alana flee.", meta.Summary)
+	s.Assert().Equal([]int{2012, 4, 11}, []int{meta.Year, meta.Month, meta.Day})
+}
+
+func (s *PurgatoryTestSuite) TestApproveTwice() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 1)
+
+	s.Require().Equal(http.StatusOK, s.approve(item.ID, 1).Code)
+	s.Assert().Equal(http.StatusConflict, s.approve(item.ID, 1).Code)
+	s.Assert().Equal(http.StatusConflict, s.approve(item.ID, 2).Code)
+	s.Assert().Equal(1, s.catalog.importCount())
+}
+
+func (s *PurgatoryTestSuite) TestApproveConcurrently() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 1)
+
+	codes := make([]int, 4)
+	var group sync.WaitGroup
+	for index := range codes {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			codes[index] = s.approve(item.ID, 1).Code
+		}()
+	}
+	group.Wait()
+
+	s.Assert().ElementsMatch([]int{http.StatusOK, http.StatusConflict, http.StatusConflict, http.StatusConflict}, codes)
+	s.Assert().Equal(1, s.catalog.importCount())
+}
+
+func (s *PurgatoryTestSuite) TestApproveWithFailingCatalog() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 1)
+	s.catalog.err = errors.New("catalog is down")
+
+	s.Assert().Equal(http.StatusInternalServerError, s.approve(item.ID, 1).Code)
+
+	// The claim is released, so the item can be approved once the catalog is back
+	stored := s.reload(item.ID)
+	s.Assert().Equal(model.StatusPending, stored.Status)
+	s.Assert().Equal(int64(1), stored.Version)
+	s.Assert().DirExists(s.itemPath(item.ID))
+
+	s.catalog.err = nil
+	s.Assert().Equal(http.StatusOK, s.approve(item.ID, 1).Code)
+	s.Assert().Equal(1, s.catalog.importCount())
+}
+
+func (s *PurgatoryTestSuite) TestApproveMissingItem() {
+	s.Assert().Equal(http.StatusNotFound, s.approve(404, 1).Code)
+	s.Assert().Equal(0, s.catalog.importCount())
+}
+
+func (s *PurgatoryTestSuite) TestApproveRequiresVersion() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 1)
+	target := fmt.Sprintf("/purgatory/%d/approve", item.ID)
+	request := dto.ApproveRequest{IssueUpdate: dto.IssueUpdateRequest{Number: "1"}, SeriesUpdate: dto.SeriesUpdateRequest{Title: "Saga"}}
+
+	s.Assert().Equal(http.StatusPreconditionRequired, s.request(http.MethodPost, target, request, nil).Code)
+	s.Assert().Equal(http.StatusBadRequest, s.request(http.MethodPost, target, request, map[string]string{"If-Match": "latest"}).Code)
+	s.Assert().Equal(http.StatusPreconditionFailed, s.approve(item.ID, 2).Code)
+	s.Assert().Equal(0, s.catalog.importCount())
+	s.Assert().Equal(model.StatusPending, s.reload(item.ID).Status)
+}
+
+func (s *PurgatoryTestSuite) TestApproveAfterEdit() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 1)
+	target := fmt.Sprintf("/purgatory/%d", item.ID)
+
+	response := s.request(http.MethodPatch, target, map[string]any{"publisher": "Image"}, map[string]string{"If-Match": `"1"`})
+	s.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+
+	// Approving what the reviewer saw before the edit must not go through
+	s.Assert().Equal(http.StatusPreconditionFailed, s.approve(item.ID, 1).Code)
+	s.Assert().Equal(http.StatusOK, s.approve(item.ID, 2).Code)
+}
+
+func (s *PurgatoryTestSuite) TestUpdateRequiresVersion() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 1)
+	target := fmt.Sprintf("/purgatory/%d", item.ID)
+	meta := model.ArchiveMeta{SeriesName: "Saga", Number: "2"}
+
+	for _, method := range []string{http.MethodPut, http.MethodPatch} {
+		s.Run(method, func() {
+			s.Assert().Equal(http.StatusPreconditionRequired, s.request(method, target, meta, nil).Code)
+			s.Assert().Equal(http.StatusBadRequest, s.request(method, target, meta, map[string]string{"If-Match": "latest"}).Code)
+			s.Assert().Equal(http.StatusPreconditionFailed, s.request(method, target, meta, map[string]string{"If-Match": `"7"`}).Code)
+		})
+	}
+
+	stored := s.reload(item.ID)
+	s.Assert().Equal(int64(1), stored.Version)
+	s.Assert().Equal("1", stored.Meta.Number)
+}
+
+func (s *PurgatoryTestSuite) TestUpdateWithStaleVersion() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 1)
+	target := fmt.Sprintf("/purgatory/%d", item.ID)
+
+	first := s.request(http.MethodPut, target, model.ArchiveMeta{SeriesName: "Saga", Number: "2"}, map[string]string{"If-Match": `"1"`})
+	s.Require().Equal(http.StatusOK, first.Code, first.Body.String())
+	s.Assert().Equal(`"2"`, first.Header().Get("ETag"))
+
+	// A second reviewer editing the same version loses
+	second := s.request(http.MethodPatch, target, map[string]any{"number": "3"}, map[string]string{"If-Match": `"1"`})
+	s.Assert().Equal(http.StatusPreconditionFailed, second.Code)
+	s.Assert().Equal("2", s.reload(item.ID).Meta.Number)
+
+	// The ETag of GET is what the next edit sends
+	current := s.request(http.MethodGet, target, nil, nil)
+	s.Require().Equal(http.StatusOK, current.Code)
+	third := s.request(http.MethodPatch, target, map[string]any{"number": "3"}, map[string]string{"If-Match": current.Header().Get("ETag")})
+	s.Assert().Equal(http.StatusOK, third.Code)
+	s.Assert().Equal("3", s.reload(item.ID).Meta.Number)
+}
+
+func (s *PurgatoryTestSuite) TestUpdateKeepsPagesCount() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1", PagesCount: 2}, 2)
+	target := fmt.Sprintf("/purgatory/%d", item.ID)
+
+	response := s.request(http.MethodPut, target, model.ArchiveMeta{SeriesName: "Saga", Number: "2"}, map[string]string{"If-Match": `"1"`})
+	s.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+	s.Assert().Equal(2, s.reload(item.ID).Meta.PagesCount)
+
+	response = s.request(http.MethodPatch, target, map[string]any{"pagesCount": 7}, map[string]string{"If-Match": `"2"`})
+	s.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+	s.Assert().Equal(2, s.reload(item.ID).Meta.PagesCount)
+}
+
+// An edit must not slip in while the catalog imports the item, as approval would overwrite it
+func (s *PurgatoryTestSuite) TestUpdateDuringApproval() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 1)
+	s.Require().NoError(s.db.Model(&item).Updates(map[string]any{"status": model.StatusApproving, "version": 2}).Error)
+	target := fmt.Sprintf("/purgatory/%d", item.ID)
+
+	for _, version := range []string{`"1"`, `"2"`} {
+		response := s.request(http.MethodPatch, target, map[string]any{"number": "3"}, map[string]string{"If-Match": version})
+		s.Assert().Equal(http.StatusConflict, response.Code, response.Body.String())
+	}
+	s.Assert().Equal("1", s.reload(item.ID).Meta.Number)
+}
+
+// Values a metadata file gets wrong are dropped on ingestion, so they don't fail the next edit
+func (s *PurgatoryTestSuite) TestUpdateIngestedMeta() {
+	s.Require().NoError(s.container.JobService.Start())
+
+	comicInfo := `<ComicInfo>
+  <Series>Saga</Series>
+  <Number>54</Number>
+  <Month>13</Month>
+  <AgeRating>T+</AgeRating>
+  <LanguageISO>English</LanguageISO>
+  <CommunityRating>9</CommunityRating>
+</ComicInfo>`
+	id := s.ingest("Saga 054.cbz", s.withEntry(s.comicArchive(10), "ComicInfo.xml", comicInfo))
+
+	meta := s.reload(id).Meta
+	s.Assert().Zero(meta.Month)
+	s.Assert().Empty(meta.AgeRating)
+	s.Assert().Empty(meta.LanguageISO)
+	s.Assert().Zero(meta.CommunityRating)
+
+	response := s.request(http.MethodPatch, fmt.Sprintf("/purgatory/%d", id), map[string]any{"publisher": "Image"}, map[string]string{"If-Match": `"1"`})
+	s.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+	s.Assert().Equal("Image", s.reload(id).Meta.Publisher)
+}
+
+func (s *PurgatoryTestSuite) TestReject() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 2)
+
+	response := s.request(http.MethodPost, fmt.Sprintf("/purgatory/%d/reject", item.ID), dto.RejectRequest{Reason: "Missing pages"}, nil)
+
+	s.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+	var rejection model.Rejection
+	s.Require().NoError(s.db.Where("item_id = ?", item.ID).First(&rejection).Error)
+	s.Assert().Equal("Missing pages", rejection.Reason)
+	s.Assert().Equal("Saga", rejection.Meta.SeriesName)
+
+	s.Assert().ErrorIs(s.db.First(&model.PurgatoryItem{}, item.ID).Error, gorm.ErrRecordNotFound)
+	s.Assert().NoDirExists(s.itemPath(item.ID))
+}
+
+func (s *PurgatoryTestSuite) TestRejectWithoutReason() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 1)
+
+	response := s.request(http.MethodPost, fmt.Sprintf("/purgatory/%d/reject", item.ID), dto.RejectRequest{}, nil)
+
+	s.Assert().Equal(http.StatusBadRequest, response.Code)
+	s.Assert().Equal(model.StatusPending, s.reload(item.ID).Status)
+	s.Assert().DirExists(s.itemPath(item.ID))
+}
+
+func (s *PurgatoryTestSuite) TestRejectApprovedItem() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 1)
+	s.Require().Equal(http.StatusOK, s.approve(item.ID, 1).Code)
+
+	response := s.request(http.MethodPost, fmt.Sprintf("/purgatory/%d/reject", item.ID), dto.RejectRequest{Reason: "Too late"}, nil)
+
+	s.Assert().Equal(http.StatusConflict, response.Code)
+	s.Assert().Equal(model.StatusApproved, s.reload(item.ID).Status)
+}
+
+func (s *PurgatoryTestSuite) TestRejectMissingItem() {
+	response := s.request(http.MethodPost, "/purgatory/404/reject", dto.RejectRequest{Reason: "Missing pages"}, nil)
+
+	s.Assert().Equal(http.StatusNotFound, response.Code)
+}
+
+func (s *PurgatoryTestSuite) TestDelete() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 2)
+	other := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "2"}, 1)
+
+	response := s.request(http.MethodDelete, fmt.Sprintf("/purgatory/%d", item.ID), nil, nil)
+
+	s.Require().Equal(http.StatusNoContent, response.Code)
+	s.Assert().ErrorIs(s.db.First(&model.PurgatoryItem{}, item.ID).Error, gorm.ErrRecordNotFound)
+	s.Assert().NoDirExists(s.itemPath(item.ID))
+
+	var rejections int64
+	s.Require().NoError(s.db.Model(&model.Rejection{}).Count(&rejections).Error)
+	s.Assert().Zero(rejections)
+
+	// Other items keep their pages
+	s.Assert().DirExists(s.itemPath(other.ID))
+	s.Assert().Equal(http.StatusNotFound, s.request(http.MethodDelete, fmt.Sprintf("/purgatory/%d", item.ID), nil, nil).Code)
+}
+
+func (s *PurgatoryTestSuite) TestDeleteItemUnderApproval() {
+	for _, status := range []string{model.StatusApproving, model.StatusApproved} {
+		s.Run(status, func() {
+			item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 1)
+			s.Require().NoError(s.db.Model(&item).Update("status", status).Error)
+
+			response := s.request(http.MethodDelete, fmt.Sprintf("/purgatory/%d", item.ID), nil, nil)
+
+			s.Assert().Equal(http.StatusConflict, response.Code)
+			s.Assert().Equal(status, s.reload(item.ID).Status)
+			s.Assert().DirExists(s.itemPath(item.ID))
+		})
+	}
+}
+
+func (s *PurgatoryTestSuite) TestDeleteInvalidId() {
+	s.Assert().Equal(http.StatusBadRequest, s.request(http.MethodDelete, "/purgatory/abc", nil, nil).Code)
+}
+
+// list fetches a page of items, failing the test unless the listing succeeds
+func (s *PurgatoryTestSuite) list(query string) dto.PurgatoryPage {
+	response := s.request(http.MethodGet, "/purgatory?"+query, nil, nil)
+	s.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+
+	var page dto.PurgatoryPage
+	s.Require().NoError(json.Unmarshal(response.Body.Bytes(), &page))
+	return page
+}
+
+func listedIds(page dto.PurgatoryPage) []int64 {
+	ids := make([]int64, 0, len(page.Items))
+	for _, item := range page.Items {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+func (s *PurgatoryTestSuite) TestListStatus() {
+	first := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 0)
+	second := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "2"}, 0)
+	approved := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "3"}, 0)
+	s.Require().NoError(s.db.Model(&approved).Update("status", model.StatusApproved).Error)
+
+	page := s.list("")
+	s.Assert().Equal(int64(2), page.Total)
+	s.Assert().ElementsMatch([]int64{first.ID, second.ID}, listedIds(page))
+
+	s.Assert().Equal([]int64{approved.ID}, listedIds(s.list("status=approved")))
+	s.Assert().Equal(int64(3), s.list("status=all").Total)
+	s.Assert().Equal(http.StatusBadRequest, s.request(http.MethodGet, "/purgatory?status=deleted", nil, nil).Code)
+}
+
+func (s *PurgatoryTestSuite) TestListFilters() {
+	saga := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1", Publisher: "Image Comics"}, 0)
+	sagaTwo := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "2", Publisher: "Image Comics"}, 0)
+	batman := s.createItem(&model.ArchiveMeta{SeriesName: "Batman", Number: "1", Publisher: "DC Comics"}, 0)
+
+	s.Assert().ElementsMatch([]int64{saga.ID, sagaTwo.ID}, listedIds(s.list("seriesName=SAG")))
+	s.Assert().ElementsMatch([]int64{batman.ID}, listedIds(s.list("publisher=dc")))
+	s.Assert().ElementsMatch([]int64{saga.ID, batman.ID}, listedIds(s.list("number=1")))
+	s.Assert().ElementsMatch([]int64{saga.ID}, listedIds(s.list("seriesName=saga&number=1")))
+	s.Assert().Empty(listedIds(s.list("seriesName=Spawn")))
+}
+
+func (s *PurgatoryTestSuite) TestListFiltersMatchWildcardsLiterally() {
+	percent := s.createItem(&model.ArchiveMeta{SeriesName: "100% Daredevil", Publisher: "Panini_Comics", Number: "1"}, 0)
+	s.createItem(&model.ArchiveMeta{SeriesName: "100 Bullets", Publisher: "PaniniXComics", Number: "1"}, 0)
+
+	s.Assert().Equal([]int64{percent.ID}, listedIds(s.list("seriesName="+url.QueryEscape("100%"))))
+	s.Assert().Equal([]int64{percent.ID}, listedIds(s.list("publisher=i_C")))
+	s.Assert().Empty(listedIds(s.list("seriesName=" + url.QueryEscape("%"+"Bullets%"))))
+	s.Assert().Empty(listedIds(s.list("seriesName=" + url.QueryEscape(`\`))))
+}
+
+func (s *PurgatoryTestSuite) TestListUploadDates() {
+	old := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 0)
+	recent := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "2"}, 0)
+	s.Require().NoError(s.db.Model(&old).Update("uploaded_at", time.Date(2024, 1, 10, 23, 30, 0, 0, time.UTC)).Error)
+	s.Require().NoError(s.db.Model(&recent).Update("uploaded_at", time.Date(2024, 1, 11, 0, 30, 0, 0, time.UTC)).Error)
+
+	// The upper bound includes the whole day
+	s.Assert().Equal([]int64{old.ID}, listedIds(s.list("uploadedFrom=2024-01-10&uploadedTo=2024-01-10")))
+	s.Assert().Equal([]int64{recent.ID}, listedIds(s.list("uploadedFrom=2024-01-11")))
+	s.Assert().Equal(http.StatusBadRequest, s.request(http.MethodGet, "/purgatory?uploadedFrom=10.01.2024", nil, nil).Code)
+}
+
+func (s *PurgatoryTestSuite) TestListSort() {
+	ten := s.createItem(&model.ArchiveMeta{SeriesName: "Batman", Number: "10"}, 0)
+	two := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "2"}, 0)
+	half := s.createItem(&model.ArchiveMeta{SeriesName: "Astro City", Number: "1.5"}, 0)
+
+	// Numbers are compared as numbers, not text
+	s.Assert().Equal([]int64{half.ID, two.ID, ten.ID}, listedIds(s.list("sort=number")))
+	s.Assert().Equal([]int64{ten.ID, two.ID, half.ID}, listedIds(s.list("sort=number,desc")))
+	s.Assert().Equal([]int64{two.ID, ten.ID, half.ID}, listedIds(s.list("sort=seriesName,DESC")))
+	// Newest uploads come first by default
+	s.Assert().Equal([]int64{half.ID, two.ID, ten.ID}, listedIds(s.list("")))
+
+	for _, query := range []string{"sort=meta", "sort=number,sideways", "sort=id;drop table purgatory"} {
+		s.Run(query, func() {
+			s.Assert().Equal(http.StatusBadRequest, s.request(http.MethodGet, "/purgatory?"+url.PathEscape(query), nil, nil).Code)
+		})
+	}
+}
+
+func (s *PurgatoryTestSuite) TestListPagination() {
+	var ids []int64
+	for number := range 5 {
+		ids = append(ids, s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: strconv.Itoa(number + 1)}, 0).ID)
+	}
+
+	page := s.list("sort=id&size=2&page=1")
+	s.Assert().Equal(int64(5), page.Total)
+	s.Assert().Equal(1, page.Page)
+	s.Assert().Equal(2, page.Size)
+	s.Assert().Equal(ids[2:4], listedIds(page))
+
+	s.Assert().Equal(ids[4:], listedIds(s.list("sort=id&size=2&page=2")))
+	s.Assert().Empty(listedIds(s.list("sort=id&size=2&page=3")))
+	s.Assert().Equal(20, s.list("").Size)
+
+	for _, query := range []string{"size=201", "size=-1", "page=-1", "page=first"} {
+		s.Run(query, func() {
+			s.Assert().Equal(http.StatusBadRequest, s.request(http.MethodGet, "/purgatory?"+query, nil, nil).Code)
+		})
+	}
+}
+
+func (s *PurgatoryTestSuite) TestGetItem() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 2)
+
+	// Go can't decode AVIF, so its format comes from extraction
+	s.Require().NoError(os.WriteFile(filepath.Join(s.itemPath(item.ID), "002.avif"), []byte("not decodable"), 0644))
+	item.Pages[0].Chapter = "Chapter 1"
+	item.Pages = append(item.Pages, model.Page{Index: 2, File: "002.avif", Format: "avif"})
+	s.Require().NoError(s.db.Model(&item).Select("Pages").Updates(&item).Error)
+
+	response := s.request(http.MethodGet, fmt.Sprintf("/purgatory/%d", item.ID), nil, nil)
+
+	s.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+	s.Assert().Equal(`"1"`, response.Header().Get("ETag"))
+
+	var details dto.PurgatoryItemDetails
+	s.Require().NoError(json.Unmarshal(response.Body.Bytes(), &details))
+	s.Assert().Equal(item.ID, details.ID)
+	s.Assert().Equal("Saga", details.Meta.SeriesName)
+	s.Require().Len(details.Pages, 3)
+
+	stat, err := os.Stat(filepath.Join(s.itemPath(item.ID), "001.png"))
+	s.Require().NoError(err)
+	s.Assert().Equal(dto.PageFile{Index: 1, Name: "001.png", Size: stat.Size(), Format: "png", Width: 21, Height: 30}, details.Pages[1])
+	s.Assert().Equal("Chapter 1", details.Pages[0].Chapter)
+	s.Assert().Equal(dto.PageFile{Index: 2, Name: "002.avif", Size: 13, Format: "avif"}, details.Pages[2])
+}
+
+func (s *PurgatoryTestSuite) TestGetItemWithoutPages() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 0)
+	s.Require().NoError(os.RemoveAll(s.itemPath(item.ID)))
+
+	response := s.request(http.MethodGet, fmt.Sprintf("/purgatory/%d", item.ID), nil, nil)
+
+	s.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+	var details dto.PurgatoryItemDetails
+	s.Require().NoError(json.Unmarshal(response.Body.Bytes(), &details))
+	s.Assert().NotNil(details.Pages)
+	s.Assert().Empty(details.Pages)
+}
+
+func (s *PurgatoryTestSuite) TestGetMissingItem() {
+	s.Assert().Equal(http.StatusNotFound, s.request(http.MethodGet, "/purgatory/404", nil, nil).Code)
+	s.Assert().Equal(http.StatusBadRequest, s.request(http.MethodGet, "/purgatory/abc", nil, nil).Code)
+}
+
+func (s *PurgatoryTestSuite) TestGetPage() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 2)
+	content, err := os.ReadFile(filepath.Join(s.itemPath(item.ID), "001.png"))
+	s.Require().NoError(err)
+
+	response := s.request(http.MethodGet, fmt.Sprintf("/purgatory/%d/pages/1", item.ID), nil, nil)
+
+	s.Require().Equal(http.StatusOK, response.Code)
+	s.Assert().Equal("image/png", response.Header().Get("Content-Type"))
+	s.Assert().NotEmpty(response.Header().Get("ETag"))
+	s.Assert().NotEmpty(response.Header().Get("Last-Modified"))
+	s.Assert().Equal(content, response.Body.Bytes())
+}
+
+func (s *PurgatoryTestSuite) TestGetPageSniffsContentType() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 1)
+	directory := s.itemPath(item.ID)
+	s.Require().NoError(os.Rename(filepath.Join(directory, "000.png"), filepath.Join(directory, "000.jpg")))
+
+	response := s.request(http.MethodGet, fmt.Sprintf("/purgatory/%d/pages/0", item.ID), nil, nil)
+
+	s.Require().Equal(http.StatusOK, response.Code)
+	s.Assert().Equal("image/png", response.Header().Get("Content-Type"))
+}
+
+func (s *PurgatoryTestSuite) TestGetPageConditionally() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 1)
+	target := fmt.Sprintf("/purgatory/%d/pages/0", item.ID)
+
+	first := s.request(http.MethodGet, target, nil, nil)
+	s.Require().Equal(http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+
+	notModified := s.request(http.MethodGet, target, nil, map[string]string{"If-None-Match": etag})
+	s.Assert().Equal(http.StatusNotModified, notModified.Code)
+	s.Assert().Empty(notModified.Body.Bytes())
+	s.Assert().Equal(etag, notModified.Header().Get("ETag"))
+
+	notModified = s.request(http.MethodGet, target, nil, map[string]string{"If-Modified-Since": first.Header().Get("Last-Modified")})
+	s.Assert().Equal(http.StatusNotModified, notModified.Code)
+
+	// A replaced page gets a new tag
+	later := time.Now().Add(time.Hour)
+	s.Require().NoError(os.Chtimes(filepath.Join(s.itemPath(item.ID), "000.png"), later, later))
+	modified := s.request(http.MethodGet, target, nil, map[string]string{"If-None-Match": etag})
+	s.Assert().Equal(http.StatusOK, modified.Code)
+	s.Assert().NotEqual(etag, modified.Header().Get("ETag"))
+}
+
+func (s *PurgatoryTestSuite) TestGetPageRange() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 1)
+	content, err := os.ReadFile(filepath.Join(s.itemPath(item.ID), "000.png"))
+	s.Require().NoError(err)
+
+	response := s.request(http.MethodGet, fmt.Sprintf("/purgatory/%d/pages/0", item.ID), nil, map[string]string{"Range": "bytes=0-7"})
+
+	s.Require().Equal(http.StatusPartialContent, response.Code)
+	s.Assert().Equal(content[:8], response.Body.Bytes())
+	s.Assert().Equal(fmt.Sprintf("bytes 0-7/%d", len(content)), response.Header().Get("Content-Range"))
+}
+
+func (s *PurgatoryTestSuite) TestGetMissingPage() {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: "Saga", Number: "1"}, 2)
+
+	s.Assert().Equal(http.StatusNotFound, s.request(http.MethodGet, fmt.Sprintf("/purgatory/%d/pages/2", item.ID), nil, nil).Code)
+	s.Assert().Equal(http.StatusNotFound, s.request(http.MethodGet, fmt.Sprintf("/purgatory/%d/pages/-1", item.ID), nil, nil).Code)
+	s.Assert().Equal(http.StatusNotFound, s.request(http.MethodGet, "/purgatory/404/pages/0", nil, nil).Code)
+	s.Assert().Equal(http.StatusBadRequest, s.request(http.MethodGet, fmt.Sprintf("/purgatory/%d/pages/first", item.ID), nil, nil).Code)
+}
+
+// comicArchive packs one page per shade into a cbz, so different shades make different archives
+func (s *PurgatoryTestSuite) comicArchive(shades ...uint8) []byte {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for index, shade := range shades {
+		page := image.NewGray(image.Rect(0, 0, 40, 60))
+		for y := range 60 {
+			for x := range 40 {
+				page.SetGray(x, y, color.Gray{Y: shade + uint8(x)})
+			}
+		}
+
+		entry, err := writer.Create(fmt.Sprintf("%03d.png", index))
+		s.Require().NoError(err)
+		s.Require().NoError(png.Encode(entry, page))
+	}
+	s.Require().NoError(writer.Close())
+
+	return buffer.Bytes()
+}
+
+// withEntry copies an archive, adding a file like a metadata file to it
+func (s *PurgatoryTestSuite) withEntry(archive []byte, name string, content string) []byte {
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	s.Require().NoError(err)
+
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for _, file := range reader.File {
+		s.Require().NoError(writer.Copy(file))
+	}
+
+	entry, err := writer.Create(name)
+	s.Require().NoError(err)
+	_, err = entry.Write([]byte(content))
+	s.Require().NoError(err)
+	s.Require().NoError(writer.Close())
+
+	return buffer.Bytes()
+}
+
+func (s *PurgatoryTestSuite) upload(name string, content []byte) model.Job {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", name)
+	s.Require().NoError(err)
+	_, err = part.Write(content)
+	s.Require().NoError(err)
+	s.Require().NoError(writer.Close())
+
+	request := httptest.NewRequest(http.MethodPost, "/purgatory", &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	response := httptest.NewRecorder()
+	s.router.ServeHTTP(response, request)
+	s.Require().Equal(http.StatusAccepted, response.Code, response.Body.String())
+
+	var job model.Job
+	s.Require().NoError(json.Unmarshal(response.Body.Bytes(), &job))
+	return job
+}
+
+// queueJob stores a job the way an earlier run of the service left it
+func (s *PurgatoryTestSuite) queueJob(name string, content []byte, state string) model.Job {
+	uploads := filepath.Join(s.filesPath, "uploads")
+	s.Require().NoError(os.MkdirAll(uploads, 0755))
+
+	job := model.Job{ID: fmt.Sprintf("job-%d", time.Now().UnixNano()), FileName: name, State: state}
+	job.Path = filepath.Join(uploads, job.ID+filepath.Ext(name))
+	s.Require().NoError(os.WriteFile(job.Path, content, 0644))
+	s.Require().NoError(s.db.Create(&job).Error)
+
+	return job
+}
+
+// waitForJob polls the job endpoint until the job is done or failed
+func (s *PurgatoryTestSuite) waitForJob(id string) model.Job {
+	var job model.Job
+	s.Require().Eventually(func() bool {
+		response := s.request(http.MethodGet, "/jobs/"+id, nil, nil)
+		if response.Code != http.StatusOK || json.Unmarshal(response.Body.Bytes(), &job) != nil {
+			return false
+		}
+		return job.State == model.JobDone || job.State == model.JobFailed
+	}, 30*time.Second, 50*time.Millisecond)
+
+	return job
+}
+
+func (s *PurgatoryTestSuite) TestJobWorkersSkipLockedJobs() {
+	locked := s.queueJob("locked.cbz", s.comicArchive(10, 11), model.JobQueued)
+	free := s.queueJob("free.cbz", s.comicArchive(20, 21), model.JobQueued)
+
+	// Another worker holding the older job must not keep this one waiting
+	transaction := s.db.Begin()
+	s.Require().NoError(transaction.Exec("select id from purgatory_job where id = ? for update", locked.ID).Error)
+
+	s.Require().NoError(s.container.JobService.Start())
+
+	s.Assert().Equal(model.JobDone, s.waitForJob(free.ID).State)
+	current, err := s.container.JobService.Get(locked.ID)
+	s.Require().NoError(err)
+	s.Assert().Equal(model.JobQueued, current.State)
+
+	s.Require().NoError(transaction.Rollback().Error)
+
+	// A new upload wakes a worker, which picks the released job up first
+	woken := s.upload("woken.cbz", s.comicArchive(30, 31))
+	s.Assert().Equal(model.JobDone, s.waitForJob(locked.ID).State)
+	s.Assert().Equal(model.JobDone, s.waitForJob(woken.ID).State)
+}
+
+func (s *PurgatoryTestSuite) TestJobsClaimedOnce() {
+	s.Require().NoError(s.container.JobService.Start())
+
+	jobs := make([]model.Job, 6)
+	for index := range jobs {
+		jobs[index] = s.upload(fmt.Sprintf("issue %d.cbz", index+1), s.comicArchive(uint8(index*40), uint8(index*40+1)))
+	}
+
+	items := map[int64]bool{}
+	for _, job := range jobs {
+		done := s.waitForJob(job.ID)
+		s.Require().Equal(model.JobDone, done.State, done.Error)
+		s.Require().NotNil(done.ItemID)
+		items[*done.ItemID] = true
+	}
+
+	var count int64
+	s.Require().NoError(s.db.Model(&model.PurgatoryItem{}).Count(&count).Error)
+	s.Assert().Len(items, len(jobs))
+	s.Assert().Equal(int64(len(jobs)), count)
+}
+
+func (s *PurgatoryTestSuite) TestStartRequeuesInterruptedJobs() {
+	interrupted := s.queueJob("interrupted.cbz", s.comicArchive(50, 51), model.JobExtracting)
+	s.Require().NoError(s.db.Model(&interrupted).Update("progress", 40).Error)
+
+	s.Require().NoError(s.container.JobService.Start())
+
+	done := s.waitForJob(interrupted.ID)
+	s.Require().Equal(model.JobDone, done.State, done.Error)
+	s.Assert().Equal(100, done.Progress)
+	s.Require().NotNil(done.ItemID)
+	s.Assert().Len(s.reload(*done.ItemID).Pages, 2)
+	s.Assert().NoFileExists(interrupted.Path)
+}
+
+// A crash mid-extraction leaves a pending item without pages, which the retry replaces
+func (s *PurgatoryTestSuite) TestStartDiscardsHalfExtractedItems() {
+	interrupted := s.queueJob("Saga 054.cbz", s.comicArchive(50, 51), model.JobExtracting)
+	orphan := model.PurgatoryItem{Meta: &model.ArchiveMeta{SeriesName: "Saga", Number: "54"}, Status: model.StatusPending}
+	s.Require().NoError(s.db.Create(&orphan).Error)
+	s.Require().NoError(os.MkdirAll(s.itemPath(orphan.ID), 0755))
+	s.Require().NoError(s.db.Model(&interrupted).Update("item_id", orphan.ID).Error)
+
+	s.Require().NoError(s.container.JobService.Start())
+
+	done := s.waitForJob(interrupted.ID)
+	s.Require().Equal(model.JobDone, done.State, done.Error)
+	s.Require().NotNil(done.ItemID)
+	s.Assert().NotEqual(orphan.ID, *done.ItemID)
+	s.Assert().ErrorIs(s.db.First(&model.PurgatoryItem{}, orphan.ID).Error, gorm.ErrRecordNotFound)
+	s.Assert().NoDirExists(s.itemPath(orphan.ID))
+	s.Assert().Equal([]int64{*done.ItemID}, listedIds(s.list("")))
+}
+
+func (s *PurgatoryTestSuite) TestFailedJob() {
+	s.Require().NoError(s.container.JobService.Start())
+
+	job := s.upload("broken.cbz", []byte("not a zip archive"))
+
+	failed := s.waitForJob(job.ID)
+	s.Assert().Equal(model.JobFailed, failed.State)
+	s.Assert().NotEmpty(failed.Error)
+	s.Assert().Nil(failed.ItemID)
+
+	uploads, err := os.ReadDir(filepath.Join(s.filesPath, "uploads"))
+	s.Require().NoError(err)
+	s.Assert().Empty(uploads)
+}
+
+func (s *PurgatoryTestSuite) TestGetMissingJob() {
+	s.Assert().Equal(http.StatusNotFound, s.request(http.MethodGet, "/jobs/missing", nil, nil).Code)
+}
+
+// ingest uploads an archive and waits for the item it becomes
+func (s *PurgatoryTestSuite) ingest(name string, content []byte) int64 {
+	job := s.waitForJob(s.upload(name, content).ID)
+	s.Require().Equal(model.JobDone, job.State, job.Error)
+	s.Require().NotNil(job.ItemID)
+
+	return *job.ItemID
+}
+
+func (s *PurgatoryTestSuite) duplicates(id int64) []model.DuplicateCandidate {
+	response := s.request(http.MethodGet, fmt.Sprintf("/purgatory/%d/duplicates", id), nil, nil)
+	s.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+
+	var candidates []model.DuplicateCandidate
+	s.Require().NoError(json.Unmarshal(response.Body.Bytes(), &candidates))
+	return candidates
+}
+
+func (s *PurgatoryTestSuite) TestSimilarSeriesStaySeparate() {
+	s.Require().NoError(s.container.JobService.Start())
+
+	batman := s.ingest("Batman 001.cbz", s.comicArchive(10, 11))
+	beyond := s.ingest("Batman Beyond 001.cbz", s.comicArchive(60, 61))
+
+	s.Assert().NotEqual(batman, beyond)
+	s.Assert().Equal("Batman", s.reload(batman).Meta.SeriesName)
+	s.Assert().Equal("Batman Beyond", s.reload(beyond).Meta.SeriesName)
+	s.Assert().Empty(s.duplicates(batman))
+	s.Assert().Empty(s.duplicates(beyond))
+}
+
+func (s *PurgatoryTestSuite) TestDuplicatesSharingPages() {
+	s.Require().NoError(s.container.JobService.Start())
+
+	original := s.ingest("Saga 001.cbz", s.comicArchive(10, 11, 12))
+	repack := s.ingest("Saga Repack.cbz", s.comicArchive(10, 11, 12, 13))
+
+	var hashes int64
+	s.Require().NoError(s.db.Model(&model.PageHash{}).Where("item_id = ?", original).Count(&hashes).Error)
+	s.Assert().Equal(int64(3), hashes)
+
+	candidates := s.duplicates(repack)
+	s.Require().Len(candidates, 1)
+	s.Assert().Equal(original, candidates[0].ItemID)
+	s.Assert().Equal(1.0, candidates[0].PageOverlap)
+	s.Require().NotNil(s.reload(repack).OverlapsWith)
+	s.Assert().Equal(original, *s.reload(repack).OverlapsWith)
+
+	// Candidates are scored on request, so a deleted item is gone from them at once
+	s.Require().Equal(http.StatusNoContent, s.request(http.MethodDelete, fmt.Sprintf("/purgatory/%d", original), nil, nil).Code)
+	s.Require().NoError(s.db.Model(&model.PageHash{}).Where("item_id = ?", original).Count(&hashes).Error)
+	s.Assert().Zero(hashes)
+	s.Assert().Empty(s.duplicates(repack))
+	s.Assert().Nil(s.reload(repack).OverlapsWith)
+}
+
+func (s *PurgatoryTestSuite) TestUploadAfterFailedExtraction() {
+	s.Require().NoError(s.container.JobService.Start())
+	archive := s.comicArchive(10, 11)
+
+	// A file where the first item's pages go makes its extraction fail
+	s.Require().NoError(os.WriteFile(s.itemPath(1), []byte("in the way"), 0644))
+
+	failed := s.waitForJob(s.upload("Saga 001.cbz", archive).ID)
+	s.Require().Equal(model.JobFailed, failed.State)
+
+	var count int64
+	s.Require().NoError(s.db.Model(&model.PurgatoryItem{}).Count(&count).Error)
+	s.Assert().Zero(count)
+
+	// The same archive uploaded again is extracted anew rather than matched to the failed item
+	id := s.ingest("Saga 001.cbz", archive)
+	s.Assert().NotEqual(int64(1), id)
+
+	item := s.reload(id)
+	s.Assert().Len(item.Pages, 2)
+	s.Assert().NotEmpty(item.ArchiveHash)
+	s.Assert().DirExists(s.itemPath(id))
+
+	// From now on the finished item is returned
+	s.Assert().Equal(id, s.ingest("Saga 001.cbz", archive))
+	s.Require().NoError(s.db.Model(&model.PurgatoryItem{}).Count(&count).Error)
+	s.Assert().Equal(int64(1), count)
+}
+
+// createLookalike stores an item whose pages have the given perceptual hashes
+func (s *PurgatoryTestSuite) createLookalike(seriesName string, hashes ...string) int64 {
+	item := s.createItem(&model.ArchiveMeta{SeriesName: seriesName, Number: "1", PagesCount: len(hashes)}, 0)
+	for index, hash := range hashes {
+		item.Pages = append(item.Pages, model.Page{Index: index, File: fmt.Sprintf("%03d.jpg", index), PerceptualHash: hash})
+	}
+	item.CoverHash = hashes[0]
+	s.Require().NoError(s.db.Model(&item).Select("Pages", "CoverHash").Updates(&item).Error)
+
+	return item.ID
+}
+
+func (s *PurgatoryTestSuite) TestVisualDuplicates() {
+	saga := s.createLookalike("Saga", "0123456789abcdef", "0f0f0f0f0f0f0f0f")
+	sagaRescan := s.createLookalike("Saga (rescan)", "0123456789abcdee", "0f0f0f0f0f0f0f0f")
+	batman := s.createLookalike("Batman", "3c3c3c3c3c3c3c3c", "5a5a5a5a5a5a5a5a")
+	// Another cover in front of the same pages
+	batmanVariant := s.createLookalike("Batman (variant)", "fedcba9876543210", "3c3c3c3c3c3c3c3c", "5a5a5a5a5a5a5a5a")
+	approved := s.createLookalike("Saga", "0123456789abcdef", "0f0f0f0f0f0f0f0f")
+	s.Require().NoError(s.db.Model(&model.PurgatoryItem{}).Where("id = ?", approved).Update("status", model.StatusApproved).Error)
+
+	response := s.request(http.MethodGet, "/purgatory/similar?size=1", nil, nil)
+	s.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+
+	var page dto.VisualDuplicatePage
+	s.Require().NoError(json.Unmarshal(response.Body.Bytes(), &page))
+	s.Assert().Equal(int64(2), page.Total)
+	s.Require().Len(page.Items, 1)
+	s.Require().Len(page.Items[0].Items, 2)
+	s.Assert().Equal(saga, page.Items[0].Items[0].ID)
+	s.Assert().Equal("Saga", page.Items[0].Items[0].SeriesName)
+	s.Assert().Equal(2, page.Items[0].Items[0].PagesCount)
+	s.Assert().Equal(sagaRescan, page.Items[0].Items[1].ID)
+	s.Require().Len(page.Items[0].Matches, 1)
+	s.Assert().Equal(1, page.Items[0].Matches[0].CoverDistance)
+
+	response = s.request(http.MethodGet, "/purgatory/similar?size=1&page=1", nil, nil)
+	s.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+	s.Require().NoError(json.Unmarshal(response.Body.Bytes(), &page))
+	s.Require().Len(page.Items, 1)
+	s.Assert().Equal([]int64{batman, batmanVariant}, []int64{page.Items[0].Items[0].ID, page.Items[0].Items[1].ID})
+	s.Assert().Equal(1.0, page.Items[0].Matches[0].PageSimilarity)
+
+	response = s.request(http.MethodGet, "/purgatory/similar?size=1&page=2", nil, nil)
+	s.Require().NoError(json.Unmarshal(response.Body.Bytes(), &page))
+	s.Assert().Empty(page.Items)
+	s.Assert().Equal(int64(2), page.Total)
+
+	s.Assert().Equal(http.StatusBadRequest, s.request(http.MethodGet, "/purgatory/similar?size=201", nil, nil).Code)
+}
+
+func TestPurgatory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	suite.Run(t, new(PurgatoryTestSuite))
+}
@@ -1,20 +1,198 @@
 package model
 
+import "time"
+
+const (
+	StatusPending = "pending"
+	// StatusApproving marks an item being imported into the catalog
+	StatusApproving = "approving"
+	StatusApproved  = "approved"
+)
+
 type PurgatoryItem struct {
-	ID   int64        `gorm:"unique;primaryKey;autoIncrement" json:"id"`
-	Meta *ArchiveMeta `gorm:"type:jsonb;serializer:json" json:"meta"`
+	ID         int64        `gorm:"unique;primaryKey;autoIncrement" json:"id"`
+	Meta       *ArchiveMeta `gorm:"type:jsonb;serializer:json" json:"meta"`
+	Status     string       `gorm:"not null;default:pending" json:"status"`
+	UploadedAt time.Time    `gorm:"autoCreateTime;not null;default:now()" json:"uploadedAt"`
+	Version    int64        `gorm:"not null;default:1" json:"version"`
+	Pages      []Page       `gorm:"type:jsonb;serializer:json" json:"pages,omitempty"`
+	Chapters   []Chapter    `gorm:"type:jsonb;serializer:json" json:"chapters,omitempty"`
+	// SeriesKey is the series name folded for matching duplicates
+	SeriesKey string `gorm:"index" json:"-"`
+	// ArchiveHash is the SHA-256 of the uploaded archive
+	ArchiveHash string `gorm:"index" json:"archiveHash,omitempty"`
+	// OverlapsWith flags an upload whose pages are mostly found in another item
+	OverlapsWith *int64 `gorm:"index" json:"overlapsWith,omitempty"`
+	// CoverHash is the perceptual hash of the first page
+	CoverHash string `json:"coverHash,omitempty"`
 }
 
 func (PurgatoryItem) TableName() string {
 	return "purgatory"
 }
 
+const (
+	YesNoUnknown = "Unknown"
+	YesNoNo      = "No"
+	YesNoYes     = "Yes"
+	// MangaYesAndRightToLeft marks manga that is read right to left
+	MangaYesAndRightToLeft = "YesAndRightToLeft"
+)
+
+// ArchiveMeta follows the Anansi ComicInfo v2.1 schema. Comma separated ComicInfo lists,
+// like creators and genres, are kept as arrays.
 type ArchiveMeta struct {
 	SeriesName string `json:"seriesName"`
 	Number     string `json:"number"`
 	Summary    string `json:"summary"`
 	Publisher  string `json:"publisher"`
 	PagesCount int    `json:"pagesCount"`
+
+	Title           string `json:"title,omitempty"`
+	Volume          int    `json:"volume,omitempty"`
+	Count           int    `json:"count,omitempty"`
+	AlternateSeries string `json:"alternateSeries,omitempty"`
+	AlternateNumber string `json:"alternateNumber,omitempty"`
+	AlternateCount  int    `json:"alternateCount,omitempty"`
+	Notes           string `json:"notes,omitempty"`
+
+	Year  int `json:"year,omitempty"`
+	Month int `json:"month,omitempty"`
+	Day   int `json:"day,omitempty"`
+
+	Writer      []string `json:"writer,omitempty"`
+	Penciller   []string `json:"penciller,omitempty"`
+	Inker       []string `json:"inker,omitempty"`
+	Colorist    []string `json:"colorist,omitempty"`
+	Letterer    []string `json:"letterer,omitempty"`
+	CoverArtist []string `json:"coverArtist,omitempty"`
+	Editor      []string `json:"editor,omitempty"`
+	Translator  []string `json:"translator,omitempty"`
+
+	Imprint     string   `json:"imprint,omitempty"`
+	Genre       []string `json:"genre,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Web         []string `json:"web,omitempty"`
+	LanguageISO string   `json:"languageIso,omitempty"`
+	Format      string   `json:"format,omitempty"`
+	AgeRating   string   `json:"ageRating,omitempty"`
+
+	BlackAndWhite   string  `json:"blackAndWhite,omitempty"`
+	Manga           string  `json:"manga,omitempty"`
+	CommunityRating float64 `json:"communityRating,omitempty"`
+	Review          string  `json:"review,omitempty"`
+	ScanInformation string  `json:"scanInformation,omitempty"`
+
+	StoryArc       string `json:"storyArc,omitempty"`
+	StoryArcNumber string `json:"storyArcNumber,omitempty"`
+	SeriesGroup    string `json:"seriesGroup,omitempty"`
+	GTIN           string `json:"gtin,omitempty"`
+
+	Characters          []string `json:"characters,omitempty"`
+	Teams               []string `json:"teams,omitempty"`
+	Locations           []string `json:"locations,omitempty"`
+	MainCharacterOrTeam string   `json:"mainCharacterOrTeam,omitempty"`
+}
+
+// Page types of the ComicInfo <Pages> element
+const (
+	PageTypeFrontCover    = "FrontCover"
+	PageTypeInnerCover    = "InnerCover"
+	PageTypeRoundup       = "Roundup"
+	PageTypeStory         = "Story"
+	PageTypeAdvertisement = "Advertisement"
+	PageTypeEditorial     = "Editorial"
+	PageTypeLetters       = "Letters"
+	PageTypePreview       = "Preview"
+	PageTypeBackCover     = "BackCover"
+	PageTypeOther         = "Other"
+	PageTypeDeleted       = "Deleted"
+)
+
+// Page is an extracted page file, in reading order
+type Page struct {
+	Index  int    `json:"index"`
+	File   string `json:"file"`
+	Format string `json:"format"`
+	// Chapter is the folder the page was stored in inside the archive
+	Chapter string `json:"chapter,omitempty"`
+
+	// Attributes below come from the ComicInfo page list, when the archive has one
+	Type       string `json:"type,omitempty"`
+	DoublePage bool   `json:"doublePage,omitempty"`
+	Bookmark   string `json:"bookmark,omitempty"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+
+	// Hash is the SHA-256 of the page file
+	Hash string `json:"hash,omitempty"`
+	// PerceptualHash is the dHash of the page, which other scans of it come close to
+	PerceptualHash string `json:"perceptualHash,omitempty"`
+}
+
+// Chapter is a run of pages that came from the same archive folder
+type Chapter struct {
+	Title      string `json:"title"`
+	FirstPage  int    `json:"firstPage"`
+	PagesCount int    `json:"pagesCount"`
+}
+
+// DuplicateCandidate is an item another one may duplicate, with the evidence found for it
+type DuplicateCandidate struct {
+	ItemID int64 `json:"itemId"`
+	// Confidence goes from 0 to 1, where 1 means the very same archive
+	Confidence float64  `json:"confidence"`
+	Reasons    []string `json:"reasons"`
+	// PageOverlap is the share of the smaller item's pages the other one holds byte for byte
+	PageOverlap float64 `json:"pageOverlap,omitempty"`
+}
+
+// PageHash indexes the SHA-256 of a page by item, so items sharing pages are found
+// without unpacking the pages of every item
+type PageHash struct {
+	ItemID int64  `gorm:"primaryKey"`
+	Hash   string `gorm:"primaryKey;index"`
+}
+
+func (PageHash) TableName() string {
+	return "purgatory_page_hash"
+}
+
+type Rejection struct {
+	ID         int64        `gorm:"unique;primaryKey;autoIncrement" json:"id"`
+	ItemID     int64        `json:"itemId"`
+	Meta       *ArchiveMeta `gorm:"type:jsonb;serializer:json" json:"meta"`
+	Reason     string       `json:"reason"`
+	RejectedBy string       `json:"rejectedBy"`
+	RejectedAt time.Time    `gorm:"autoCreateTime" json:"rejectedAt"`
+}
+
+func (Rejection) TableName() string {
+	return "purgatory_rejection"
+}
+
+const (
+	JobQueued     = "queued"
+	JobExtracting = "extracting"
+	JobDone       = "done"
+	JobFailed     = "failed"
+)
+
+type Job struct {
+	ID       string `gorm:"primaryKey" json:"id"`
+	FileName string `json:"fileName"`
+	Path     string `json:"-"`
+	State    string `gorm:"not null;default:queued;index" json:"state"`
+	Progress int    `json:"progress"`
+	Error    string `json:"error,omitempty"`
+	// ItemID is set as soon as the item is created, while its pages are still being extracted
+	ItemID    *int64    `json:"itemId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (Job) TableName() string {
+	return "purgatory_job"
 }
 
 type User struct {
@@ -1,207 +1,241 @@
 package service
 
 import (
-	"bytes"
-	"encoding/xml"
 	"fmt"
 	"os"
-	"regexp"
+	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
-
-	"golang.org/x/net/html/charset"
+	"unicode"
 
 	"paper/purgatory/model"
 )
 
 type ArchiveTool interface {
 	GetMeta(input *os.File, size int64) (*model.ArchiveMeta, error)
-	Extract(input *os.File, destination string) error
+	Extract(input *os.File, destination string) ([]model.Page, error)
 }
 
 type baseArchiveTool struct {
 	fileName string
+	// pageAttributes holds the ComicInfo page list read by GetMeta until Extract applies it
+	pageAttributes map[int]comicPage
 }
 
-var (
-	seriesNameRegex = regexp.MustCompile(`^[A-Za-z\d)(.\-" ']+ \d{1,3}`)
-	numberRegex     = regexp.MustCompile(`\d+`)
-
-	infoFileName = "comicinfo.xml"
-)
+// resolveSeriesName parses the series from the file name. Names that are just a number
+// fall back to what the file name shares with the first page, e.g. "054.cbz" and "Saga 054 01.jpg".
+func (b *baseArchiveTool) resolveSeriesName(firstPage string) string {
+	if series := parseFileName(b.fileName).Series; series != "" {
+		return series
+	}
 
-func (b *baseArchiveTool) extractSeriesNameFromFileName(fileName string) string {
-	normalized := strings.ReplaceAll(fileName, "_", " ")
-	match := seriesNameRegex.FindString(normalized)
-	if match == "" {
-		return fileName
+	if crossed := b.crossNames(b.fileName, firstPage); crossed != "" {
+		return crossed
 	}
 
-	lastIndexOfSpace := strings.LastIndex(match, " ")
-	if lastIndexOfSpace == -1 {
-		return fileName
+	return b.fileName
+}
+
+// resolveNumber parses the issue from the file name, or else from the series name,
+// which comes from titles like "Saga #54" for some formats
+func (b *baseArchiveTool) resolveNumber(seriesName string) string {
+	if issue := parseFileName(b.fileName).Issue; issue != "" {
+		return issue
 	}
 
-	return strings.TrimSpace(match[:lastIndexOfSpace])
+	return parseFileName(seriesName).Issue
 }
 
-func (b *baseArchiveTool) extractMetaFromXml(path string) (*model.ArchiveMeta, error) {
-	xmlContent, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read XML file: %v", err)
+// normalizeNumber reads the issue number metadata provides, which may come with extra text
+func (b *baseArchiveTool) normalizeNumber(value string) string {
+	value = strings.TrimSpace(value)
+	if match := issueTokenRegex.FindStringSubmatch(value); match != nil && (match[2] != "" || match[3] == "½") {
+		return normalizeIssue(value)
 	}
 
-	type ComicInfo struct {
-		XMLName   xml.Name `xml:"ComicInfo"`
-		Title     string   `xml:"Title"`
-		Number    string   `xml:"Number"`
-		Issue     string   `xml:"Issue"`
-		Series    string   `xml:"Series"`
-		Publisher string   `xml:"Publisher"`
-		Summary   string   `xml:"Summary"`
+	for _, word := range strings.Fields(value) {
+		if isIssueToken(word) {
+			return normalizeIssue(word)
+		}
 	}
 
-	// Handle XML encoding (common issue with ComicInfo files)
-	reader := bytes.NewReader(xmlContent)
-	decoder := xml.NewDecoder(reader)
-	decoder.CharsetReader = charset.NewReaderLabel
+	return ""
+}
 
-	var comicInfo ComicInfo
-	if err := decoder.Decode(&comicInfo); err != nil {
-		return nil, fmt.Errorf("failed to parse XML: %v", err)
-	}
+// crossNames returns the common start of two names, compared rune by rune
+// regardless of case and width
+func (b *baseArchiveTool) crossNames(name1, name2 string) string {
+	runes1 := []rune(normalizeName(name1))
+	runes2 := []rune(normalizeName(name2))
+	minLen := min(len(runes1), len(runes2))
 
-	title := strings.TrimSpace(comicInfo.Series)
-	if title == "" {
-		title = strings.TrimSpace(comicInfo.Title)
-	}
+	var result strings.Builder
+	for i := 0; i < minLen; i++ {
+		if unicode.IsSpace(runes1[i]) || unicode.IsSpace(runes2[i]) {
+			result.WriteRune(' ')
+			continue
+		}
 
-	number := ""
-	for _, n := range []string{
-		strings.TrimSpace(comicInfo.Number),
-		strings.TrimSpace(comicInfo.Issue),
-		strings.TrimSpace(comicInfo.Title),
-	} {
-		if n != "" {
-			number = n
+		if runes1[i] != runes2[i] && foldName(string(runes1[i])) != foldName(string(runes2[i])) {
 			break
 		}
+
+		result.WriteRune(runes1[i])
 	}
 
-	return &model.ArchiveMeta{
-		SeriesName: title,
-		Publisher:  strings.TrimSpace(comicInfo.Publisher),
-		Summary:    strings.TrimSpace(comicInfo.Summary),
-		Number:     b.extractFirstNumber(number),
-		PagesCount: 0,
-	}, nil
+	return strings.TrimSpace(result.String())
 }
 
-func (b *baseArchiveTool) extractNumberFromFileName(fileName string) string {
-	normalized := strings.ReplaceAll(fileName, "_", " ")
-	match := seriesNameRegex.FindString(normalized)
-	if match == "" {
-		return fileName
-	}
-
-	lastIndexOfSpace := strings.LastIndex(match, " ")
-	if lastIndexOfSpace == -1 {
-		return fileName
-	}
+// entryPath is a temporary name for an extracted entry. Entry names can't be used,
+// as chapter folders often repeat the same page names.
+func (b *baseArchiveTool) entryPath(destination string, index int) string {
+	return filepath.Join(destination, fmt.Sprintf(".entry-%d", index))
+}
 
-	numberStr := strings.TrimSpace(match[lastIndexOfSpace:])
-	return b.parseNumber(numberStr)
+// extractedFile is an archive entry written to disk, still under a temporary name
+type extractedFile struct {
+	path string
+	// name is the entry path inside the archive, which decides the page order
+	name string
 }
 
-func (b *baseArchiveTool) extractNumber(fileName, seriesName string) string {
-	if len(fileName) <= len(seriesName)+1 {
-		return ""
-	}
+// renameFiles names extracted files sequentially with the extension of their detected format.
+// Files that aren't images (Thumbs.db, scanner notes, ...) are removed instead of becoming pages,
+// as are images the ComicInfo page list marks as deleted.
+func (b *baseArchiveTool) renameFiles(destination string, extractedFiles []extractedFile) ([]model.Page, error) {
+	sortPages(extractedFiles, func(file extractedFile) string {
+		return file.name
+	})
+
+	var images []extractedFile
+	var pages []model.Page
+	imageIndex := 0
+	for _, file := range extractedFiles {
+		format, err := detectImageFormat(file.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s: %v", file.name, err)
+		}
 
-	substring := fileName[len(seriesName)+1:]
-	indexOfSpace := strings.Index(substring, " ")
-	if indexOfSpace == -1 {
-		return ""
+		page := model.Page{Format: format}
+		if format != "" {
+			// ComicInfo refers to pages by their position among the archive's images
+			if attributes, ok := b.pageAttributes[imageIndex]; ok {
+				attributes.apply(&page)
+			}
+			imageIndex++
+		}
+
+		if format == "" || page.Type == model.PageTypeDeleted {
+			if err := os.Remove(file.path); err != nil {
+				return nil, fmt.Errorf("failed to remove file %s: %v", file.path, err)
+			}
+			continue
+		}
+
+		images = append(images, file)
+		pages = append(pages, page)
 	}
 
-	numberStr := strings.TrimSpace(substring[:indexOfSpace])
-	match := numberRegex.FindString(numberStr)
-	if match == "" {
-		return ""
+	// Extracted names may clash with the sequential ones, so every file is moved aside first
+	staged := make([]string, len(images))
+	for index, file := range images {
+		staged[index] = filepath.Join(destination, fmt.Sprintf(".page-%d", index))
+		if err := os.Rename(file.path, staged[index]); err != nil {
+			return nil, fmt.Errorf("failed to rename file %s to %s: %v", file.path, staged[index], err)
+		}
 	}
 
-	return b.parseNumber(match)
-}
+	digits := len(strconv.Itoa(len(images)))
+	chapterPrefix := commonFolder(images)
 
-func (b *baseArchiveTool) extractFirstNumber(str string) string {
-	match := numberRegex.FindString(str)
-	if match == "" {
-		return ""
-	}
-	return b.parseNumber(match)
-}
+	for index, stagedPath := range staged {
+		newFilename := fmt.Sprintf("%0*d%s", digits, index, formatExtensions[pages[index].Format])
+		newPath := filepath.Join(destination, newFilename)
 
-func (b *baseArchiveTool) parseNumber(numberStr string) string {
-	// Try parsing as integer first
-	if num, err := strconv.Atoi(numberStr); err == nil {
-		return strconv.Itoa(num)
+		if err := os.Rename(stagedPath, newPath); err != nil {
+			return nil, fmt.Errorf("failed to rename file %s to %s: %v", stagedPath, newPath, err)
+		}
+
+		pages[index].Index = index
+		pages[index].File = newFilename
+		pages[index].Chapter = strings.TrimSuffix(strings.TrimPrefix(entryFolder(images[index].name)+"/", chapterPrefix), "/")
 	}
 
-	// Try parsing as float
-	if num, err := strconv.ParseFloat(numberStr, 64); err == nil {
-		return fmt.Sprintf("%g", num)
+	if pages == nil {
+		pages = []model.Page{}
 	}
 
-	// Return as string if parsing fails
-	return numberStr
+	return pages, nil
 }
 
-func (b *baseArchiveTool) crossNames(name1, name2 string) string {
-	minLen := min(len(name1), len(name2))
-	name1Lower := strings.ToLower(name1)
-	name2Lower := strings.ToLower(name2)
-
-	var result strings.Builder
-	for i := 0; i < minLen; i++ {
-		if name1Lower[i] == ' ' || name2Lower[i] == ' ' {
-			result.WriteRune(' ')
-			continue
+// countPages estimates the page count from entry names before anything is extracted
+func (b *baseArchiveTool) countPages(descriptors []string) int {
+	count := 0
+	for _, descriptor := range descriptors {
+		if isImageFile(descriptor) {
+			count++
 		}
+	}
 
-		if name1Lower[i] != name2Lower[i] {
-			break
+	for index, attributes := range b.pageAttributes {
+		if index < count && attributes.Type == model.PageTypeDeleted {
+			count--
 		}
-
-		result.WriteByte(name1[i])
 	}
 
-	return strings.TrimSpace(result.String())
+	return count
 }
 
-func (b *baseArchiveTool) resolveNumber(seriesName string) string {
-	number1 := b.extractNumber(b.fileName, seriesName)
-	number2 := b.extractNumberFromFileName(b.fileName)
+// commonFolder is the folder every page lives in, e.g. the issue folder a scanner zipped up,
+// which isn't a chapter of its own
+func commonFolder(files []extractedFile) string {
+	if len(files) == 0 {
+		return ""
+	}
 
-	if number1 != "" {
-		return number1
-	} else if number2 != "" {
-		return number2
+	prefix := entryFolder(files[0].name)
+	for _, file := range files[1:] {
+		folder := entryFolder(file.name)
+		for prefix != "" && folder != prefix && !strings.HasPrefix(folder, prefix+"/") {
+			prefix = path.Dir(prefix)
+			if prefix == "." {
+				prefix = ""
+			}
+		}
 	}
 
-	return ""
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
 }
 
-func (b *baseArchiveTool) resolveSeriesName(firstPage string) string {
-	seriesName1 := b.crossNames(b.fileName, firstPage)
-	seriesName2 := b.extractSeriesNameFromFileName(b.fileName)
-
-	seriesName := b.fileName
-	if seriesName1 != b.fileName && seriesName1 != "" {
-		seriesName = seriesName1
+func entryFolder(name string) string {
+	folder := path.Dir(strings.Join(splitEntryPath(name), "/"))
+	if folder == "." {
+		return ""
 	}
-	if seriesName2 != b.fileName && seriesName2 != "" && len(seriesName2) < len(seriesName) {
-		seriesName = seriesName2
+	return folder
+}
+
+// groupChapters records where each chapter folder starts. Pages outside any folder,
+// like a cover next to the chapter folders, don't form a chapter.
+func groupChapters(pages []model.Page) []model.Chapter {
+	var chapters []model.Chapter
+	for _, page := range pages {
+		if page.Chapter == "" {
+			continue
+		}
+
+		last := len(chapters) - 1
+		if last >= 0 && chapters[last].Title == page.Chapter && chapters[last].FirstPage+chapters[last].PagesCount == page.Index {
+			chapters[last].PagesCount++
+			continue
+		}
+
+		chapters = append(chapters, model.Chapter{Title: page.Chapter, FirstPage: page.Index, PagesCount: 1})
 	}
 
-	return seriesName
+	return chapters
 }
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func openFixture(t *testing.T, name string) (*os.File, int64) {
+	file, err := os.Open(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = file.Close() })
+
+	info, err := file.Stat()
+	require.NoError(t, err)
+
+	return file, info.Size()
+}
+
+// extractedNames lists the files an archive tool extracted, in directory order
+func extractedNames(t *testing.T, destination string) []string {
+	entries, err := os.ReadDir(destination)
+	require.NoError(t, err)
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	return names
+}
+
+func readZipEntry(t *testing.T, fixture string, name string) []byte {
+	reader, err := zip.OpenReader(filepath.Join("testdata", fixture))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = reader.Close() })
+
+	entry, err := reader.Open(name)
+	require.NoError(t, err)
+	defer func() { _ = entry.Close() }()
+
+	content, err := io.ReadAll(entry)
+	require.NoError(t, err)
+
+	return content
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"paper/purgatory/utils"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// BatchOrderUpload keeps pages in the order their multipart fields were sent
+	BatchOrderUpload = "upload"
+	// BatchOrderNatural sorts pages by file name the way archive entries are sorted
+	BatchOrderNatural = "natural"
+)
+
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+	".bmp":  true,
+	".tif":  true,
+	".tiff": true,
+}
+
+func isImageFile(name string) bool {
+	return imageExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// packImages stores a batch of loose pages as a cbz, so it's ingested like any other archive.
+// Entries are numbered in page order, which is the order the archive tools extract them in.
+func packImages(files []*multipart.FileHeader, order string, path string) error {
+	pages := make([]*multipart.FileHeader, len(files))
+	copy(pages, files)
+
+	if order == BatchOrderNatural {
+		sortPages(pages, func(page *multipart.FileHeader) string {
+			return page.Filename
+		})
+	}
+
+	output, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer utils.HandleClose(output.Close)
+
+	writer := zip.NewWriter(output)
+	digits := len(strconv.Itoa(len(pages)))
+
+	for index, page := range pages {
+		name := fmt.Sprintf("page-%0*d%s", digits, index, strings.ToLower(filepath.Ext(page.Filename)))
+		if err := copyPage(writer, page, name); err != nil {
+			utils.HandleRemove(os.Remove, path)
+			return err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		utils.HandleRemove(os.Remove, path)
+		return fmt.Errorf("failed to finish batch archive: %v", err)
+	}
+
+	return nil
+}
+
+func copyPage(writer *zip.Writer, page *multipart.FileHeader, name string) error {
+	src, err := page.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open page %s: %v", page.Filename, err)
+	}
+	defer utils.HandleClose(src.Close)
+
+	// Images are compressed already, so they are stored as is
+	entry, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		return fmt.Errorf("failed to add page %s: %v", page.Filename, err)
+	}
+
+	if _, err := io.Copy(entry, src); err != nil {
+		return fmt.Errorf("failed to copy page %s: %v", page.Filename, err)
+	}
+
+	return nil
+}
+
+// batchName derives the issue name from what the page names share, e.g. "Saga_054" for "Saga_054_01.jpg"
+func batchName(files []*multipart.FileHeader) string {
+	prefix := strings.TrimSuffix(files[0].Filename, filepath.Ext(files[0].Filename))
+	for _, file := range files[1:] {
+		name := file.Filename
+		length := 0
+		for length < len(prefix) && length < len(name) && prefix[length] == name[length] {
+			length++
+		}
+		prefix = prefix[:length]
+	}
+
+	// A prefix ending inside a number, like the "0" shared by pages 01 to 09, isn't part of the name
+	for _, file := range files {
+		if len(file.Filename) > len(prefix) && isDigit(file.Filename[len(prefix)]) {
+			prefix = strings.TrimRightFunc(prefix, unicode.IsDigit)
+			break
+		}
+	}
+
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+
+	prefix = strings.TrimRight(prefix, " _-.")
+	if prefix == "" {
+		return strings.TrimSuffix(files[0].Filename, filepath.Ext(files[0].Filename))
+	}
+
+	return prefix
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"bytes"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+func uploadPages(t *testing.T, names ...string) []*multipart.FileHeader {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, name := range names {
+		part, err := writer.CreateFormFile("files", name)
+		require.NoError(t, err)
+		// A PNG signature is enough for the page to be detected as an image
+		_, err = part.Write([]byte(pngSignature + name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(1 << 20)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = form.RemoveAll() })
+
+	return form.File["files"]
+}
+
+func TestPackImagesOrder(t *testing.T) {
+	pages := uploadPages(t, "Saga_054_10.jpg", "Saga_054_2.png", "Saga_054_1.jpg")
+
+	tests := []struct {
+		order    string
+		expected []string
+	}{
+		{BatchOrderUpload, []string{"Saga_054_10.jpg", "Saga_054_2.png", "Saga_054_1.jpg"}},
+		{BatchOrderNatural, []string{"Saga_054_1.jpg", "Saga_054_2.png", "Saga_054_10.jpg"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.order, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "batch.cbz")
+			require.NoError(t, packImages(pages, test.order, path))
+
+			file, err := os.Open(path)
+			require.NoError(t, err)
+			defer func() { _ = file.Close() }()
+
+			destination := t.TempDir()
+			pages, err := NewCbzTool("Saga_054.cbz").Extract(file, destination)
+			require.NoError(t, err)
+
+			entries, err := os.ReadDir(destination)
+			require.NoError(t, err)
+			require.Len(t, entries, len(test.expected))
+			require.Len(t, pages, len(test.expected))
+
+			for index, entry := range entries {
+				content, err := os.ReadFile(filepath.Join(destination, entry.Name()))
+				require.NoError(t, err)
+				require.Equal(t, pngSignature+test.expected[index], string(content))
+				require.Equal(t, "png", pages[index].Format)
+			}
+		})
+	}
+}
+
+func TestBatchName(t *testing.T) {
+	tests := []struct {
+		files    []string
+		expected string
+	}{
+		{[]string{"Saga_054_01.jpg", "Saga_054_02.jpg"}, "Saga_054"},
+		{[]string{"Saga 054 - 01.jpg", "Saga 054 - 12.jpg"}, "Saga 054"},
+		{[]string{"Saga 054.jpg"}, "Saga 054"},
+		{[]string{"001.jpg", "002.jpg"}, "001"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, batchName(uploadPages(t, test.files...)))
+	}
+}
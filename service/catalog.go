@@ -0,0 +1,98 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"paper/purgatory/dto"
+	"paper/purgatory/utils"
+	"path/filepath"
+	"time"
+)
+
+type CatalogClient interface {
+	Import(request dto.ApproveRequest, pages []string, authorization string) error
+}
+
+type catalogClient struct {
+	url    string
+	client *http.Client
+}
+
+func InitCatalogClient(url string) CatalogClient {
+	return &catalogClient{url: url, client: &http.Client{Timeout: 5 * time.Minute}}
+}
+
+func (c *catalogClient) Import(request dto.ApproveRequest, pages []string, authorization string) error {
+	// Pages are streamed through a pipe so that large issues are never buffered in memory
+	body, pipeWriter := io.Pipe()
+	writer := multipart.NewWriter(pipeWriter)
+	go func() {
+		pipeWriter.CloseWithError(c.writeImportBody(writer, request, pages))
+	}()
+
+	httpRequest, err := http.NewRequest(http.MethodPost, c.url+"/issues/import", body)
+	if err != nil {
+		utils.HandleClose(body.Close)
+		return fmt.Errorf("failed to create catalog request: %v", err)
+	}
+
+	httpRequest.Header.Set("Content-Type", writer.FormDataContentType())
+	if authorization != "" {
+		httpRequest.Header.Set("Authorization", authorization)
+	}
+
+	response, err := c.client.Do(httpRequest)
+	if err != nil {
+		return fmt.Errorf("failed to call catalog: %v", err)
+	}
+	defer utils.HandleClose(response.Body.Close)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("catalog responded with %d: %s", response.StatusCode, message)
+	}
+
+	return nil
+}
+
+func (c *catalogClient) writeImportBody(writer *multipart.Writer, request dto.ApproveRequest, pages []string) error {
+	meta, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal approve request: %v", err)
+	}
+
+	if err := writer.WriteField("meta", string(meta)); err != nil {
+		return fmt.Errorf("failed to write meta field: %v", err)
+	}
+
+	for _, page := range pages {
+		if err := c.writePage(writer, page); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+func (c *catalogClient) writePage(writer *multipart.Writer, page string) error {
+	file, err := os.Open(page)
+	if err != nil {
+		return fmt.Errorf("failed to open page %s: %v", page, err)
+	}
+	defer utils.HandleClose(file.Close)
+
+	part, err := writer.CreateFormFile("pages", filepath.Base(page))
+	if err != nil {
+		return fmt.Errorf("failed to create page part %s: %v", page, err)
+	}
+
+	if _, err := io.Copy(part, file); err != nil {
+		return fmt.Errorf("failed to copy page %s: %v", page, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"paper/purgatory/model"
+	"strings"
+	"time"
+)
+
+// coMet is the CoMet 1.1 schema (http://www.denvog.com/comet/), stored under any XML file name
+type coMet struct {
+	Title            string   `xml:"title"`
+	Description      string   `xml:"description"`
+	Series           string   `xml:"series"`
+	Issue            string   `xml:"issue"`
+	Volume           string   `xml:"volume"`
+	Publisher        string   `xml:"publisher"`
+	Date             string   `xml:"date"`
+	Genres           []string `xml:"genre"`
+	Characters       []string `xml:"character"`
+	Format           string   `xml:"format"`
+	Language         string   `xml:"language"`
+	Rating           string   `xml:"rating"`
+	Identifier       string   `xml:"identifier"`
+	Writers          []string `xml:"writer"`
+	Pencillers       []string `xml:"penciller"`
+	Inkers           []string `xml:"inker"`
+	Colorists        []string `xml:"colorist"`
+	Letterers        []string `xml:"letterer"`
+	CoverDesigners   []string `xml:"coverDesigner"`
+	Editors          []string `xml:"editor"`
+	ReadingDirection string   `xml:"readingDirection"`
+}
+
+func (b *baseArchiveTool) readCoMet(content []byte) (*model.ArchiveMeta, error) {
+	var info coMet
+	found, err := decodeMetadataXml(content, "comet", &info)
+	if !found {
+		// Just some other XML file, broken or not
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &model.ArchiveMeta{
+		SeriesName:  strings.TrimSpace(info.Series),
+		Summary:     strings.TrimSpace(info.Description),
+		Publisher:   strings.TrimSpace(info.Publisher),
+		Title:       truncateText(info.Title),
+		Volume:      parsePositive(info.Volume),
+		Format:      strings.TrimSpace(info.Format),
+		LanguageISO: languageCode(info.Language),
+		AgeRating:   knownValue(info.Rating, ageRatings),
+		Genre:       trimValues(info.Genres),
+		Characters:  trimValues(info.Characters),
+	}
+
+	if meta.SeriesName == "" {
+		meta.SeriesName = meta.Title
+	}
+	if issue := strings.TrimSpace(info.Issue); issue != "" {
+		meta.Number = b.normalizeNumber(issue)
+	}
+
+	// Dates may be a full date or just year and month
+	date := strings.TrimSpace(info.Date)
+	for _, layout := range []string{time.DateOnly, "2006-01", "2006"} {
+		if parsed, err := time.Parse(layout, date); err == nil {
+			meta.Year = parsed.Year()
+			if len(layout) > len("2006") {
+				meta.Month = int(parsed.Month())
+			}
+			if layout == time.DateOnly {
+				meta.Day = parsed.Day()
+			}
+			break
+		}
+	}
+
+	meta.GTIN = validGTIN(gtinDigits(strings.TrimPrefix(strings.TrimSpace(info.Identifier), "isbn:")))
+
+	if strings.EqualFold(strings.TrimSpace(info.ReadingDirection), "rtl") {
+		meta.Manga = model.MangaYesAndRightToLeft
+	}
+
+	for role, people := range map[string][]string{
+		"writer":        info.Writers,
+		"penciller":     info.Pencillers,
+		"inker":         info.Inkers,
+		"colorist":      info.Colorists,
+		"letterer":      info.Letterers,
+		"coverDesigner": info.CoverDesigners,
+		"editor":        info.Editors,
+	} {
+		for _, person := range people {
+			addCredit(meta, role, person)
+		}
+	}
+
+	return meta, nil
+}
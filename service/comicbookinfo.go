@@ -0,0 +1,102 @@
+package service
+
+import (
+	"encoding/json"
+	"paper/purgatory/model"
+	"strings"
+)
+
+const comicBookInfoKey = "ComicBookInfo/1.0"
+
+// comicBookInfo is the ComicBookInfo JSON that ComicRack and ComicTagger store in the zip comment
+type comicBookInfo struct {
+	Series           string                `json:"series"`
+	Title            string                `json:"title"`
+	Publisher        string                `json:"publisher"`
+	PublicationMonth int                   `json:"publicationMonth"`
+	PublicationYear  int                   `json:"publicationYear"`
+	Issue            json.RawMessage       `json:"issue"`
+	NumberOfIssues   int                   `json:"numberOfIssues"`
+	Volume           int                   `json:"volume"`
+	Genre            string                `json:"genre"`
+	Language         string                `json:"language"`
+	Rating           float64               `json:"rating"`
+	Credits          []comicBookInfoCredit `json:"credits"`
+	Tags             []string              `json:"tags"`
+	Comments         string                `json:"comments"`
+}
+
+type comicBookInfoCredit struct {
+	Person string `json:"person"`
+	Role   string `json:"role"`
+}
+
+// parseComicBookInfo reads the zip comment, which is usually empty or unrelated text
+func parseComicBookInfo(comment string) (*comicBookInfo, bool) {
+	if !strings.Contains(comment, comicBookInfoKey) {
+		return nil, false
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(comment), &envelope); err != nil {
+		return nil, false
+	}
+
+	var info comicBookInfo
+	if err := json.Unmarshal(envelope[comicBookInfoKey], &info); err != nil {
+		return nil, false
+	}
+
+	return &info, true
+}
+
+func (c *comicBookInfo) meta() *model.ArchiveMeta {
+	meta := &model.ArchiveMeta{
+		SeriesName: strings.TrimSpace(c.Series),
+		Number:     c.issue(),
+		Summary:    strings.TrimSpace(c.Comments),
+		Publisher:  strings.TrimSpace(c.Publisher),
+		Title:      truncateText(c.Title),
+		Volume:     max(c.Volume, 0),
+		Count:      max(c.NumberOfIssues, 0),
+		Year:       max(c.PublicationYear, 0),
+		Genre:      splitList(c.Genre),
+	}
+
+	if c.PublicationMonth >= 1 && c.PublicationMonth <= 12 {
+		meta.Month = c.PublicationMonth
+	}
+	if c.Rating >= 0 && c.Rating <= 5 {
+		meta.CommunityRating = c.Rating
+	}
+
+	// ComicBookInfo usually names the language ("English"), only codes fit LanguageISO
+	meta.LanguageISO = languageCode(c.Language)
+
+	for _, tag := range c.Tags {
+		if trimmed := strings.TrimSpace(tag); trimmed != "" {
+			meta.Tags = append(meta.Tags, trimmed)
+		}
+	}
+
+	for _, credit := range c.Credits {
+		addCredit(meta, credit.Role, credit.Person)
+	}
+
+	return meta
+}
+
+// issue accepts both the numbers and the strings taggers write
+func (c *comicBookInfo) issue() string {
+	var number json.Number
+	if err := json.Unmarshal(c.Issue, &number); err == nil {
+		return number.String()
+	}
+
+	var text string
+	if err := json.Unmarshal(c.Issue, &text); err == nil {
+		return strings.TrimSpace(text)
+	}
+
+	return ""
+}
@@ -0,0 +1,310 @@
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"paper/purgatory/model"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/language"
+)
+
+// comicInfo is the Anansi ComicInfo v2.1 schema. Numbers are read as text,
+// because taggers happily write values like "" or "2020-01" into them.
+type comicInfo struct {
+	XMLName             xml.Name    `xml:"ComicInfo"`
+	Title               string      `xml:"Title"`
+	Series              string      `xml:"Series"`
+	Number              string      `xml:"Number"`
+	Issue               string      `xml:"Issue"`
+	Count               string      `xml:"Count"`
+	Volume              string      `xml:"Volume"`
+	AlternateSeries     string      `xml:"AlternateSeries"`
+	AlternateNumber     string      `xml:"AlternateNumber"`
+	AlternateCount      string      `xml:"AlternateCount"`
+	Summary             string      `xml:"Summary"`
+	Notes               string      `xml:"Notes"`
+	Year                string      `xml:"Year"`
+	Month               string      `xml:"Month"`
+	Day                 string      `xml:"Day"`
+	Writer              string      `xml:"Writer"`
+	Penciller           string      `xml:"Penciller"`
+	Inker               string      `xml:"Inker"`
+	Colorist            string      `xml:"Colorist"`
+	Letterer            string      `xml:"Letterer"`
+	CoverArtist         string      `xml:"CoverArtist"`
+	Editor              string      `xml:"Editor"`
+	Translator          string      `xml:"Translator"`
+	Publisher           string      `xml:"Publisher"`
+	Imprint             string      `xml:"Imprint"`
+	Genre               string      `xml:"Genre"`
+	Tags                string      `xml:"Tags"`
+	Web                 string      `xml:"Web"`
+	LanguageISO         string      `xml:"LanguageISO"`
+	Format              string      `xml:"Format"`
+	BlackAndWhite       string      `xml:"BlackAndWhite"`
+	Manga               string      `xml:"Manga"`
+	Characters          string      `xml:"Characters"`
+	Teams               string      `xml:"Teams"`
+	Locations           string      `xml:"Locations"`
+	MainCharacterOrTeam string      `xml:"MainCharacterOrTeam"`
+	ScanInformation     string      `xml:"ScanInformation"`
+	StoryArc            string      `xml:"StoryArc"`
+	StoryArcNumber      string      `xml:"StoryArcNumber"`
+	SeriesGroup         string      `xml:"SeriesGroup"`
+	AgeRating           string      `xml:"AgeRating"`
+	CommunityRating     string      `xml:"CommunityRating"`
+	Review              string      `xml:"Review"`
+	GTIN                string      `xml:"GTIN"`
+	Pages               []comicPage `xml:"Pages>Page"`
+}
+
+// comicPage describes the image at position Image among the archive's images
+type comicPage struct {
+	Image       int    `xml:"Image,attr"`
+	Type        string `xml:"Type,attr"`
+	DoublePage  string `xml:"DoublePage,attr"`
+	Bookmark    string `xml:"Bookmark,attr"`
+	ImageWidth  string `xml:"ImageWidth,attr"`
+	ImageHeight string `xml:"ImageHeight,attr"`
+}
+
+var pageTypes = []string{
+	model.PageTypeFrontCover, model.PageTypeInnerCover, model.PageTypeRoundup, model.PageTypeStory,
+	model.PageTypeAdvertisement, model.PageTypeEditorial, model.PageTypeLetters, model.PageTypePreview,
+	model.PageTypeBackCover, model.PageTypeOther, model.PageTypeDeleted,
+}
+
+// pageAttributes indexes the page list by image position. A page may carry
+// several types ("FrontCover Story"), only the first known one is kept.
+func (c *comicInfo) pageAttributes() map[int]comicPage {
+	if len(c.Pages) == 0 {
+		return nil
+	}
+
+	attributes := make(map[int]comicPage, len(c.Pages))
+	for _, page := range c.Pages {
+		if page.Image < 0 {
+			continue
+		}
+
+		pageType := ""
+		for _, value := range strings.Fields(page.Type) {
+			if pageType = knownValue(value, pageTypes); pageType != "" {
+				break
+			}
+		}
+		page.Type = pageType
+
+		attributes[page.Image] = page
+	}
+
+	return attributes
+}
+
+func (p comicPage) apply(page *model.Page) {
+	page.Type = p.Type
+	page.DoublePage, _ = strconv.ParseBool(strings.TrimSpace(p.DoublePage))
+	page.Bookmark = strings.TrimSpace(p.Bookmark)
+	page.Width = parsePositive(p.ImageWidth)
+	page.Height = parsePositive(p.ImageHeight)
+}
+
+func parseComicInfo(content []byte) (*comicInfo, error) {
+	// Handle XML encoding (common issue with ComicInfo files)
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	var info comicInfo
+	if err := decoder.Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to parse XML: %v", err)
+	}
+
+	return &info, nil
+}
+
+// readComicInfo reads ComicInfo.xml, remembering its page list for Extract
+func (b *baseArchiveTool) readComicInfo(content []byte) (*model.ArchiveMeta, error) {
+	comicInfo, err := parseComicInfo(content)
+	if err != nil {
+		return nil, err
+	}
+
+	title := strings.TrimSpace(comicInfo.Series)
+	if title == "" {
+		title = strings.TrimSpace(comicInfo.Title)
+	}
+
+	number := ""
+	for _, n := range []string{
+		strings.TrimSpace(comicInfo.Number),
+		strings.TrimSpace(comicInfo.Issue),
+		strings.TrimSpace(comicInfo.Title),
+	} {
+		if n != "" {
+			number = n
+			break
+		}
+	}
+
+	b.pageAttributes = comicInfo.pageAttributes()
+
+	meta := &model.ArchiveMeta{}
+	comicInfo.fillMeta(meta)
+	meta.SeriesName = title
+	meta.Number = b.normalizeNumber(number)
+
+	return meta, nil
+}
+
+// fillMeta copies everything but the series name and number, which need the tool's resolution rules
+func (c *comicInfo) fillMeta(meta *model.ArchiveMeta) {
+	meta.Title = truncateText(c.Title)
+	meta.Publisher = strings.TrimSpace(c.Publisher)
+	meta.Summary = strings.TrimSpace(c.Summary)
+	meta.Volume = parsePositive(c.Volume)
+	meta.Count = parsePositive(c.Count)
+	meta.AlternateSeries = strings.TrimSpace(c.AlternateSeries)
+	meta.AlternateNumber = strings.TrimSpace(c.AlternateNumber)
+	meta.AlternateCount = parsePositive(c.AlternateCount)
+	meta.Notes = strings.TrimSpace(c.Notes)
+
+	meta.Year = parseBounded(c.Year, 9999)
+	meta.Month = parseBounded(c.Month, 12)
+	meta.Day = parseBounded(c.Day, 31)
+	if meta.Year > 0 && meta.Month > 0 && meta.Day > time.Date(meta.Year, time.Month(meta.Month)+1, 0, 0, 0, 0, 0, time.UTC).Day() {
+		// February 30th and the like keep their month
+		meta.Day = 0
+	}
+
+	meta.Writer = splitList(c.Writer)
+	meta.Penciller = splitList(c.Penciller)
+	meta.Inker = splitList(c.Inker)
+	meta.Colorist = splitList(c.Colorist)
+	meta.Letterer = splitList(c.Letterer)
+	meta.CoverArtist = splitList(c.CoverArtist)
+	meta.Editor = splitList(c.Editor)
+	meta.Translator = splitList(c.Translator)
+
+	meta.Imprint = strings.TrimSpace(c.Imprint)
+	meta.Genre = splitList(c.Genre)
+	meta.Tags = splitList(c.Tags)
+	// Web is space separated, but comma separated lists are common too
+	meta.Web = strings.FieldsFunc(c.Web, func(char rune) bool { return char == ',' || char == ' ' || char == '\n' })
+	meta.LanguageISO = languageCode(c.LanguageISO)
+	meta.Format = strings.TrimSpace(c.Format)
+	meta.AgeRating = knownValue(c.AgeRating, ageRatings)
+
+	meta.BlackAndWhite = knownValue(c.BlackAndWhite, yesNoValues)
+	meta.Manga = knownValue(c.Manga, mangaValues)
+	if rating, err := strconv.ParseFloat(strings.TrimSpace(c.CommunityRating), 64); err == nil && rating >= 0 && rating <= 5 {
+		meta.CommunityRating = rating
+	}
+	meta.Review = strings.TrimSpace(c.Review)
+	meta.ScanInformation = strings.TrimSpace(c.ScanInformation)
+
+	meta.StoryArc = strings.TrimSpace(c.StoryArc)
+	meta.StoryArcNumber = strings.TrimSpace(c.StoryArcNumber)
+	meta.SeriesGroup = strings.TrimSpace(c.SeriesGroup)
+	meta.GTIN = validGTIN(c.GTIN)
+
+	meta.Characters = splitList(c.Characters)
+	meta.Teams = splitList(c.Teams)
+	meta.Locations = splitList(c.Locations)
+	meta.MainCharacterOrTeam = strings.TrimSpace(c.MainCharacterOrTeam)
+}
+
+var (
+	yesNoValues = []string{model.YesNoUnknown, model.YesNoNo, model.YesNoYes}
+	mangaValues = []string{model.YesNoUnknown, model.YesNoNo, model.YesNoYes, model.MangaYesAndRightToLeft}
+	gtinRegex   = regexp.MustCompile(`^(\d{8}|\d{12,14})$`)
+	// ageRatings are the AgeRating values allowed by ComicInfo v2.1
+	ageRatings = []string{
+		"Unknown", "Adults Only 18+", "Early Childhood", "Everyone", "Everyone 10+", "G",
+		"Kids to Adults", "M", "MA15+", "Mature 17+", "PG", "R18+", "Rating Pending", "Teen", "X18+",
+	}
+)
+
+// validGTIN returns the first value that passes GTIN validation, so a bad identifier in a
+// metadata file doesn't make every later edit of the item fail
+func validGTIN(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" && gtinRegex.MatchString(gtinDigits(value)) {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// gtinDigits drops the separators ISBNs are often written with
+func gtinDigits(value string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(value)
+}
+
+// splitList turns a ComicInfo comma separated list into its trimmed, non-empty values
+func splitList(value string) []string {
+	var values []string
+	for _, part := range strings.Split(value, ",") {
+		if trimmed := truncateText(part); trimmed != "" {
+			values = append(values, trimmed)
+		}
+	}
+	return values
+}
+
+// truncateText trims a value and cuts it to the 255 runes edits allow
+func truncateText(value string) string {
+	runes := []rune(strings.TrimSpace(value))
+	if len(runes) > 255 {
+		return strings.TrimSpace(string(runes[:255]))
+	}
+	return string(runes)
+}
+
+// languageCode keeps values that parse as a language tag, dropping names like "English"
+func languageCode(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) > 35 {
+		return ""
+	}
+
+	tag, err := language.Parse(value)
+	if err != nil {
+		return ""
+	}
+	return tag.String()
+}
+
+// parsePositive reads optional ComicInfo numbers, where -1 or garbage means not set
+func parsePositive(value string) int {
+	number, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || number < 0 {
+		return 0
+	}
+	return number
+}
+
+// parseBounded reads optional ComicInfo numbers that have an upper bound, like months
+func parseBounded(value string, maximum int) int {
+	if number := parsePositive(value); number <= maximum {
+		return number
+	}
+	return 0
+}
+
+// knownValue matches an enumeration value case-insensitively, dropping unknown ones
+func knownValue(value string, allowed []string) string {
+	value = strings.TrimSpace(value)
+	for _, candidate := range allowed {
+		if strings.EqualFold(candidate, value) {
+			return candidate
+		}
+	}
+	return ""
+}
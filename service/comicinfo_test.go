@@ -0,0 +1,192 @@
+package service
+
+import (
+	"paper/purgatory/model"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fullComicInfo = `<?xml version="1.0" encoding="utf-8"?>
+<ComicInfo xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <Title>The Gathering</Title>
+  <Series>Saga</Series>
+  <Number>54</Number>
+  <Count>66</Count>
+  <Volume>2012</Volume>
+  <AlternateSeries>Saga Deluxe</AlternateSeries>
+  <AlternateNumber>9</AlternateNumber>
+  <AlternateCount>-1</AlternateCount>
+  <Summary>Hazel goes to school.</Summary>
+  <Year>2018</Year>
+  <Month>7</Month>
+  <Day>25</Day>
+  <Writer>Brian K. Vaughan</Writer>
+  <Penciller>Fiona Staples</Penciller>
+  <Inker>Fiona Staples</Inker>
+  <Colorist>Fiona Staples</Colorist>
+  <Letterer>Fonografiks</Letterer>
+  <CoverArtist>Fiona Staples, Jim Lee</CoverArtist>
+  <Editor>Eric Stephenson,</Editor>
+  <Publisher>Image</Publisher>
+  <Imprint>Image Comics</Imprint>
+  <Genre>Science Fiction, Fantasy</Genre>
+  <Tags>space opera</Tags>
+  <Web>https://imagecomics.com/comics/releases/saga-54 https://example.com/saga</Web>
+  <LanguageISO>en</LanguageISO>
+  <Format>Series</Format>
+  <BlackAndWhite>no</BlackAndWhite>
+  <Manga>Yes</Manga>
+  <Characters>Hazel, Alana, Marko</Characters>
+  <Teams>The Will</Teams>
+  <Locations>Landfall, Wreath</Locations>
+  <StoryArc>Chapter Nine</StoryArc>
+  <SeriesGroup>Saga</SeriesGroup>
+  <AgeRating>Mature 17+</AgeRating>
+  <CommunityRating>4.5</CommunityRating>
+  <GTIN>978-1-5343-1349-7</GTIN>
+</ComicInfo>`
+
+func TestExtractMetaFromFullComicInfo(t *testing.T) {
+	tool := NewCbzTool("saga-54.cbz")
+	meta, err := tool.readComicInfo([]byte(fullComicInfo))
+	require.NoError(t, err)
+
+	assert.Equal(t, &model.ArchiveMeta{
+		SeriesName:      "Saga",
+		Number:          "54",
+		Summary:         "Hazel goes to school.",
+		Publisher:       "Image",
+		Title:           "The Gathering",
+		Volume:          2012,
+		Count:           66,
+		AlternateSeries: "Saga Deluxe",
+		AlternateNumber: "9",
+		Year:            2018,
+		Month:           7,
+		Day:             25,
+		Writer:          []string{"Brian K. Vaughan"},
+		Penciller:       []string{"Fiona Staples"},
+		Inker:           []string{"Fiona Staples"},
+		Colorist:        []string{"Fiona Staples"},
+		Letterer:        []string{"Fonografiks"},
+		CoverArtist:     []string{"Fiona Staples", "Jim Lee"},
+		Editor:          []string{"Eric Stephenson"},
+		Imprint:         "Image Comics",
+		Genre:           []string{"Science Fiction", "Fantasy"},
+		Tags:            []string{"space opera"},
+		Web:             []string{"https://imagecomics.com/comics/releases/saga-54", "https://example.com/saga"},
+		LanguageISO:     "en",
+		Format:          "Series",
+		AgeRating:       "Mature 17+",
+		BlackAndWhite:   model.YesNoNo,
+		Manga:           model.YesNoYes,
+		CommunityRating: 4.5,
+		StoryArc:        "Chapter Nine",
+		SeriesGroup:     "Saga",
+		GTIN:            "978-1-5343-1349-7",
+		Characters:      []string{"Hazel", "Alana", "Marko"},
+		Teams:           []string{"The Will"},
+		Locations:       []string{"Landfall", "Wreath"},
+	}, meta)
+
+	require.NoError(t, validateMeta(meta))
+}
+
+func TestComicInfoDropsValuesEditsReject(t *testing.T) {
+	meta, err := NewCbzTool("saga-54.cbz").readComicInfo([]byte(`<ComicInfo>
+  <Series>Saga</Series>
+  <Title>` + strings.Repeat("巨", 300) + `</Title>
+  <Year>2021</Year>
+  <Month>2</Month>
+  <Day>30</Day>
+  <AgeRating>T+</AgeRating>
+  <LanguageISO>English</LanguageISO>
+  <CommunityRating>9</CommunityRating>
+</ComicInfo>`))
+	require.NoError(t, err)
+
+	assert.Equal(t, 255, utf8.RuneCountInString(meta.Title))
+	assert.Equal(t, []int{2021, 2, 0}, []int{meta.Year, meta.Month, meta.Day})
+	assert.Empty(t, meta.AgeRating)
+	assert.Empty(t, meta.LanguageISO)
+	assert.Zero(t, meta.CommunityRating)
+	assert.NoError(t, validateMeta(meta))
+
+	meta, err = NewCbzTool("saga-54.cbz").readComicInfo([]byte(`<ComicInfo><Series>Saga</Series><Month>13</Month><AgeRating>teen</AgeRating></ComicInfo>`))
+	require.NoError(t, err)
+	assert.Zero(t, meta.Month)
+	assert.Equal(t, "Teen", meta.AgeRating)
+}
+
+func TestValidateComicInfo(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(meta *model.ArchiveMeta)
+		valid bool
+	}{
+		{"empty", func(meta *model.ArchiveMeta) {}, true},
+		{"full date", func(meta *model.ArchiveMeta) { meta.Year, meta.Month, meta.Day = 2020, 2, 29 }, true},
+		{"impossible date", func(meta *model.ArchiveMeta) { meta.Year, meta.Month, meta.Day = 2021, 2, 29 }, false},
+		{"month out of range", func(meta *model.ArchiveMeta) { meta.Month = 13 }, false},
+		{"negative volume", func(meta *model.ArchiveMeta) { meta.Volume = -1 }, false},
+		{"rating above five", func(meta *model.ArchiveMeta) { meta.CommunityRating = 5.5 }, false},
+		{"manga right to left", func(meta *model.ArchiveMeta) { meta.Manga = model.MangaYesAndRightToLeft }, true},
+		{"unknown manga value", func(meta *model.ArchiveMeta) { meta.Manga = "Maybe" }, false},
+		{"black and white", func(meta *model.ArchiveMeta) { meta.BlackAndWhite = model.YesNoYes }, true},
+		{"unknown age rating", func(meta *model.ArchiveMeta) { meta.AgeRating = "PG-13" }, false},
+		{"language", func(meta *model.ArchiveMeta) { meta.LanguageISO = "pt-BR" }, true},
+		{"invalid language", func(meta *model.ArchiveMeta) { meta.LanguageISO = "not a language" }, false},
+		{"isbn gtin", func(meta *model.ArchiveMeta) { meta.GTIN = "978-1-5343-1349-7" }, true},
+		{"short gtin", func(meta *model.ArchiveMeta) { meta.GTIN = "12345" }, false},
+		{"long japanese title", func(meta *model.ArchiveMeta) { meta.Title = strings.Repeat("巨", 255) }, true},
+		{"too long title", func(meta *model.ArchiveMeta) { meta.Title = strings.Repeat("巨", 256) }, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			meta := &model.ArchiveMeta{SeriesName: "Saga"}
+			test.edit(meta)
+
+			err := validateMeta(meta)
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidMeta)
+			}
+		})
+	}
+}
+
+func TestValidateComicInfoCleansLists(t *testing.T) {
+	meta := &model.ArchiveMeta{SeriesName: "Saga", Writer: []string{" Brian K. Vaughan ", "", "  "}}
+
+	require.NoError(t, validateMeta(meta))
+	assert.Equal(t, []string{"Brian K. Vaughan"}, meta.Writer)
+}
+
+func TestValidGTIN(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []string
+		expected string
+	}{
+		{"isbn with hyphens", []string{"978-1-5343-1349-7"}, "978-1-5343-1349-7"},
+		{"upc", []string{"709853021536"}, "709853021536"},
+		{"trimmed", []string{" 12345678 "}, "12345678"},
+		{"too long", []string{"70985302153605411"}, ""},
+		{"too short", []string{"12345"}, ""},
+		{"letters", []string{"978-1-5343-ABCD-7"}, ""},
+		{"first valid wins", []string{"", "12345", "709853021536"}, "709853021536"},
+		{"none", nil, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, validGTIN(test.values...))
+		})
+	}
+}
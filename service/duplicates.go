@@ -0,0 +1,238 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"paper/purgatory/model"
+	"paper/purgatory/utils"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// identicalPagesConfidence is reached when one item has all pages of the other
+	identicalPagesConfidence = 0.95
+	// sharedPageConfidence is the least a single shared page is worth
+	sharedPageConfidence = 0.5
+	// sameIssueConfidence is what the same series and number are worth, each further
+	// agreeing field adds sameIssueBonus
+	sameIssueConfidence = 0.6
+	sameIssueBonus      = 0.1
+	// heavyPageOverlap is the page overlap from which an upload is flagged, leaving room
+	// for the scanner credit pages repacks add or drop
+	heavyPageOverlap = 0.8
+)
+
+// seriesKey folds a series name for matching, ignoring case, width, punctuation and a
+// leading article, so "The Walking Dead" and "walking-dead" meet but "Batman Beyond" and
+// "Batman" don't
+func seriesKey(name string) string {
+	words := strings.FieldsFunc(foldName(name), func(char rune) bool {
+		return !unicode.IsLetter(char) && !unicode.IsNumber(char) && !unicode.IsMark(char)
+	})
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+
+	return strings.Join(words, " ")
+}
+
+// scoreDuplicate rates how likely other holds the same issue as item. The zero confidence means
+// nothing points to it, e.g. the same series and number but different volumes or years.
+func scoreDuplicate(item *model.PurgatoryItem, other *model.PurgatoryItem) model.DuplicateCandidate {
+	candidate := model.DuplicateCandidate{ItemID: other.ID, Reasons: []string{}}
+	raise := func(confidence float64, reason string) {
+		candidate.Confidence = math.Max(candidate.Confidence, confidence)
+		candidate.Reasons = append(candidate.Reasons, reason)
+	}
+
+	if item.ArchiveHash != "" && item.ArchiveHash == other.ArchiveHash {
+		raise(1, "identical archive")
+	}
+
+	if shared := sharedPages(item.Pages, other.Pages); shared > 0 {
+		total := max(len(item.Pages), len(other.Pages))
+		ratio := float64(shared) / float64(total)
+		raise(sharedPageConfidence+(identicalPagesConfidence-sharedPageConfidence)*ratio,
+			fmt.Sprintf("%d of %d pages identical", shared, total))
+
+		overlap := float64(shared) / float64(min(len(item.Pages), len(other.Pages)))
+		candidate.PageOverlap = math.Round(overlap*100) / 100
+	}
+
+	if confidence, reason := scoreSameIssue(item.Meta, other.Meta); confidence > 0 {
+		raise(confidence, reason)
+	}
+
+	candidate.Confidence = math.Round(candidate.Confidence*100) / 100
+	return candidate
+}
+
+func scoreSameIssue(meta *model.ArchiveMeta, other *model.ArchiveMeta) (float64, string) {
+	if meta == nil || other == nil {
+		return 0, ""
+	}
+
+	key := seriesKey(meta.SeriesName)
+	if key == "" || strings.TrimSpace(meta.Number) == "" || key != seriesKey(other.SeriesName) ||
+		normalizeIssue(meta.Number) != normalizeIssue(other.Number) {
+		return 0, ""
+	}
+
+	// Volumes and years are often missing, so only a known difference tells issues apart
+	if conflicts(meta.Volume, other.Volume) || conflicts(meta.Year, other.Year) {
+		return 0, ""
+	}
+
+	confidence := sameIssueConfidence
+	reasons := []string{"same series and number"}
+	if meta.Volume != 0 && meta.Volume == other.Volume {
+		confidence += sameIssueBonus
+		reasons = append(reasons, "volume")
+	}
+	if meta.Year != 0 && meta.Year == other.Year {
+		confidence += sameIssueBonus
+		reasons = append(reasons, "year")
+	}
+	if meta.PagesCount != 0 && meta.PagesCount == other.PagesCount {
+		confidence += sameIssueBonus
+		reasons = append(reasons, "pages count")
+	}
+
+	return confidence, strings.Join(reasons, ", ")
+}
+
+func conflicts(value int, other int) bool {
+	return value != 0 && other != 0 && value != other
+}
+
+// sharedPages counts the pages of one item that the other holds byte for byte
+func sharedPages(pages []model.Page, other []model.Page) int {
+	hashes := make(map[string]bool, len(other))
+	for _, page := range other {
+		if page.Hash != "" {
+			hashes[page.Hash] = true
+		}
+	}
+
+	shared := 0
+	for _, page := range pages {
+		if hashes[page.Hash] {
+			shared++
+			// A page repeated within the item must not count twice
+			delete(hashes, page.Hash)
+		}
+	}
+
+	return shared
+}
+
+// pageHashes lists the distinct page hashes of an item
+func pageHashes(pages []model.Page) []string {
+	hashes := make([]string, 0, len(pages))
+	for _, page := range pages {
+		if page.Hash != "" && !slices.Contains(hashes, page.Hash) {
+			hashes = append(hashes, page.Hash)
+		}
+	}
+
+	return hashes
+}
+
+// storePageHashes indexes the page hashes of an item for findDuplicates
+func storePageHashes(tx *gorm.DB, id int64, pages []model.Page) error {
+	hashes := pageHashes(pages)
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	rows := make([]model.PageHash, 0, len(hashes))
+	for _, hash := range hashes {
+		rows = append(rows, model.PageHash{ItemID: id, Hash: hash})
+	}
+
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+}
+
+// findDuplicates scores every other item that shares the series key, the archive or a page with the item
+func (s *purgatoryService) findDuplicates(item *model.PurgatoryItem) ([]model.DuplicateCandidate, error) {
+	matches := s.database.Where("archive_hash <> '' and archive_hash = ?", item.ArchiveHash).
+		Or("series_key <> '' and series_key = ?", item.SeriesKey)
+	if hashes := pageHashes(item.Pages); len(hashes) > 0 {
+		matches = matches.Or("id in (?)", s.database.Model(&model.PageHash{}).Select("item_id").Where("hash in ?", hashes))
+	}
+
+	var others []model.PurgatoryItem
+	if err := s.database.Where("id <> ?", item.ID).Where(matches).Find(&others).Error; err != nil {
+		return nil, err
+	}
+
+	candidates := []model.DuplicateCandidate{}
+	for index := range others {
+		if candidate := scoreDuplicate(item, &others[index]); candidate.Confidence > 0 {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Confidence != candidates[j].Confidence {
+			return candidates[i].Confidence > candidates[j].Confidence
+		}
+		return candidates[i].ItemID < candidates[j].ItemID
+	})
+
+	return candidates, nil
+}
+
+// overlappingItem picks the candidate sharing the most pages, if it shares enough of them to flag the item
+func overlappingItem(candidates []model.DuplicateCandidate) *int64 {
+	var overlapping *model.DuplicateCandidate
+	for index := range candidates {
+		candidate := &candidates[index]
+		if candidate.PageOverlap >= heavyPageOverlap && (overlapping == nil || candidate.PageOverlap > overlapping.PageOverlap) {
+			overlapping = candidate
+		}
+	}
+
+	if overlapping == nil {
+		return nil
+	}
+	return &overlapping.ItemID
+}
+
+// hashPages records the SHA-256 of every extracted page
+func hashPages(directory string, pages []model.Page) error {
+	for index := range pages {
+		file, err := os.Open(filepath.Join(directory, pages[index].File))
+		if err != nil {
+			return err
+		}
+
+		pages[index].Hash, err = hashReader(file)
+		utils.HandleClose(file.Close)
+		if err != nil {
+			return fmt.Errorf("failed to hash page %s: %v", pages[index].File, err)
+		}
+	}
+
+	return nil
+}
+
+func hashReader(reader io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"os"
+	"paper/purgatory/model"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"Batman", "batman"},
+		{"Batman Beyond", "batman beyond"},
+		{"The Walking Dead", "walking dead"},
+		{"walking-dead", "walking dead"},
+		{"Batman: Year One", "batman year one"},
+		{"  X-Men  ", "x men"},
+		{"Ｓａｇａ", "saga"},
+		{"Astérix", "astérix"},
+		{"The", "the"},
+		{"進撃の巨人", "進撃の巨人"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, seriesKey(test.name))
+		})
+	}
+}
+
+func TestScoreDuplicate(t *testing.T) {
+	pages := func(hashes ...string) []model.Page {
+		result := make([]model.Page, len(hashes))
+		for index, hash := range hashes {
+			result[index] = model.Page{Index: index, Hash: hash}
+		}
+		return result
+	}
+
+	tests := []struct {
+		name       string
+		item       model.PurgatoryItem
+		other      model.PurgatoryItem
+		confidence float64
+		reasons    []string
+	}{
+		{
+			name:       "identical archive",
+			item:       model.PurgatoryItem{ArchiveHash: "a1", Meta: &model.ArchiveMeta{SeriesName: "Saga", Number: "1"}},
+			other:      model.PurgatoryItem{ArchiveHash: "a1", Meta: &model.ArchiveMeta{SeriesName: "Renamed", Number: "9"}},
+			confidence: 1,
+			reasons:    []string{"identical archive"},
+		},
+		{
+			name:       "all pages shared",
+			item:       model.PurgatoryItem{Pages: pages("p1", "p2")},
+			other:      model.PurgatoryItem{Pages: pages("p1", "p2")},
+			confidence: 0.95,
+			reasons:    []string{"2 of 2 pages identical"},
+		},
+		{
+			name:       "some pages shared",
+			item:       model.PurgatoryItem{Pages: pages("p1", "p2", "p3", "p4")},
+			other:      model.PurgatoryItem{Pages: pages("p1", "x2", "x3", "x4")},
+			confidence: 0.61,
+			reasons:    []string{"1 of 4 pages identical"},
+		},
+		{
+			name:       "repeated page counts once",
+			item:       model.PurgatoryItem{Pages: pages("blank", "blank", "p3", "p4")},
+			other:      model.PurgatoryItem{Pages: pages("blank", "x2", "x3", "x4")},
+			confidence: 0.61,
+			reasons:    []string{"1 of 4 pages identical"},
+		},
+		{
+			name:       "same series and number",
+			item:       model.PurgatoryItem{Meta: &model.ArchiveMeta{SeriesName: "The Walking Dead", Number: "054"}},
+			other:      model.PurgatoryItem{Meta: &model.ArchiveMeta{SeriesName: "walking dead", Number: "54"}},
+			confidence: 0.6,
+			reasons:    []string{"same series and number"},
+		},
+		{
+			name:       "same volume, year and pages",
+			item:       model.PurgatoryItem{Meta: &model.ArchiveMeta{SeriesName: "X-Men", Number: "1", Volume: 2, Year: 1991, PagesCount: 30}},
+			other:      model.PurgatoryItem{Meta: &model.ArchiveMeta{SeriesName: "X-Men", Number: "1", Volume: 2, Year: 1991, PagesCount: 30}},
+			confidence: 0.9,
+			reasons:    []string{"same series and number, volume, year, pages count"},
+		},
+		{
+			name:  "different volume",
+			item:  model.PurgatoryItem{Meta: &model.ArchiveMeta{SeriesName: "X-Men", Number: "1", Volume: 2}},
+			other: model.PurgatoryItem{Meta: &model.ArchiveMeta{SeriesName: "X-Men", Number: "1", Volume: 1}},
+		},
+		{
+			name:  "different year",
+			item:  model.PurgatoryItem{Meta: &model.ArchiveMeta{SeriesName: "Batman", Number: "1", Year: 2016}},
+			other: model.PurgatoryItem{Meta: &model.ArchiveMeta{SeriesName: "Batman", Number: "1", Year: 2011}},
+		},
+		{
+			name:  "longer series name",
+			item:  model.PurgatoryItem{Meta: &model.ArchiveMeta{SeriesName: "Batman", Number: "1"}},
+			other: model.PurgatoryItem{Meta: &model.ArchiveMeta{SeriesName: "Batman Beyond", Number: "1"}},
+		},
+		{
+			name:  "different number",
+			item:  model.PurgatoryItem{Meta: &model.ArchiveMeta{SeriesName: "Saga", Number: "1"}},
+			other: model.PurgatoryItem{Meta: &model.ArchiveMeta{SeriesName: "Saga", Number: "2"}},
+		},
+		{
+			name:  "no number",
+			item:  model.PurgatoryItem{Meta: &model.ArchiveMeta{SeriesName: "Saga"}},
+			other: model.PurgatoryItem{Meta: &model.ArchiveMeta{SeriesName: "Saga", Number: "0"}},
+		},
+		{
+			name:       "pages outweigh metadata",
+			item:       model.PurgatoryItem{Pages: pages("p1"), Meta: &model.ArchiveMeta{SeriesName: "Saga", Number: "1"}},
+			other:      model.PurgatoryItem{Pages: pages("p1"), Meta: &model.ArchiveMeta{SeriesName: "Saga", Number: "1"}},
+			confidence: 0.95,
+			reasons:    []string{"1 of 1 pages identical", "same series and number"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.other.ID = 7
+			candidate := scoreDuplicate(&test.item, &test.other)
+
+			assert.Equal(t, int64(7), candidate.ItemID)
+			assert.Equal(t, test.confidence, candidate.Confidence)
+			if test.reasons == nil {
+				test.reasons = []string{}
+			}
+			assert.Equal(t, test.reasons, candidate.Reasons)
+		})
+	}
+}
+
+func TestHashPages(t *testing.T) {
+	directory := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "0.png"), []byte("page"), 0644))
+
+	pages := []model.Page{{Index: 0, File: "0.png"}}
+	require.NoError(t, hashPages(directory, pages))
+
+	assert.Equal(t, "3660315a9af3df255d8f19ab077e4797822b41488a0e2a04bc6af71213c23274", pages[0].Hash)
+}
+
+func TestPageOverlap(t *testing.T) {
+	pages := func(count int, prefix string) []model.Page {
+		result := make([]model.Page, count)
+		for index := range result {
+			result[index] = model.Page{Index: index, Hash: prefix + strconv.Itoa(index)}
+		}
+		return result
+	}
+
+	issue := model.PurgatoryItem{Pages: pages(20, "p")}
+	repack := model.PurgatoryItem{ID: 2, Pages: append(pages(18, "p"), model.Page{Hash: "credits"})}
+	collection := model.PurgatoryItem{ID: 3, Pages: append(pages(20, "p"), pages(80, "q")...)}
+	other := model.PurgatoryItem{ID: 4, Pages: append(pages(2, "p"), pages(18, "x")...)}
+
+	assert.Equal(t, 0.95, scoreDuplicate(&issue, &repack).PageOverlap)
+	assert.Equal(t, 1.0, scoreDuplicate(&issue, &collection).PageOverlap)
+	assert.Equal(t, 0.1, scoreDuplicate(&issue, &other).PageOverlap)
+
+	candidates := []model.DuplicateCandidate{
+		scoreDuplicate(&issue, &other),
+		scoreDuplicate(&issue, &repack),
+		scoreDuplicate(&issue, &collection),
+	}
+	require.NotNil(t, overlappingItem(candidates))
+	assert.Equal(t, int64(3), *overlappingItem(candidates))
+	assert.Nil(t, overlappingItem(candidates[:1]))
+	assert.Nil(t, overlappingItem(nil))
+}
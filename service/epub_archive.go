@@ -0,0 +1,334 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"paper/purgatory/model"
+	"paper/purgatory/utils"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+const epubContainerPath = "META-INF/container.xml"
+
+type EpubTool struct {
+	baseArchiveTool
+}
+
+func NewEpubTool(fileName string) *EpubTool {
+	return &EpubTool{
+		baseArchiveTool: baseArchiveTool{fileName: fileName},
+	}
+}
+
+type epubContainer struct {
+	RootFiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type opfPackage struct {
+	Metadata struct {
+		Titles       []string  `xml:"title"`
+		Publishers   []string  `xml:"publisher"`
+		Descriptions []string  `xml:"description"`
+		Metas        []opfMeta `xml:"meta"`
+	} `xml:"metadata"`
+	Manifest []opfItem `xml:"manifest>item"`
+	Spine    []struct {
+		IdRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// opfMeta covers both EPUB 3 refinements and EPUB 2 name/content pairs (e.g. calibre:series)
+type opfMeta struct {
+	ID       string `xml:"id,attr"`
+	Property string `xml:"property,attr"`
+	Refines  string `xml:"refines,attr"`
+	Name     string `xml:"name,attr"`
+	Content  string `xml:"content,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type opfItem struct {
+	ID        string `xml:"id,attr"`
+	Href      string `xml:"href,attr"`
+	MediaType string `xml:"media-type,attr"`
+}
+
+func (e *EpubTool) GetMeta(file *os.File, size int64) (*model.ArchiveMeta, error) {
+	zipReader, err := zip.NewReader(file, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zip reader: %v", err)
+	}
+
+	pkg, pages, err := e.readPackage(zipReader)
+	if err != nil {
+		return nil, err
+	}
+
+	seriesName, number := e.resolveCollection(pkg.Metadata.Metas)
+	title := firstNonEmpty(pkg.Metadata.Titles...)
+
+	if seriesName == "" {
+		seriesName = title
+	}
+	if seriesName == "" {
+		seriesName = e.resolveSeriesName(e.fileName)
+	}
+
+	if number != "" {
+		number = e.normalizeNumber(number)
+	} else {
+		number = e.resolveNumber(seriesName)
+	}
+
+	return &model.ArchiveMeta{
+		SeriesName: seriesName,
+		Number:     number,
+		Summary:    e.stripMarkup(firstNonEmpty(pkg.Metadata.Descriptions...)),
+		Publisher:  firstNonEmpty(pkg.Metadata.Publishers...),
+		PagesCount: len(pages),
+	}, nil
+}
+
+func (e *EpubTool) Extract(file *os.File, destination string) ([]model.Page, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %v", err)
+	}
+
+	zipReader, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zip reader: %v", err)
+	}
+
+	_, pages, err := e.readPackage(zipReader)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create destination directory: %v", err)
+	}
+
+	// Pages are named by their spine position, so the sequential rename keeps the reading order
+	digits := len(strconv.Itoa(len(pages)))
+	var extractedFiles []extractedFile
+
+	for index, page := range pages {
+		outputPath := filepath.Join(destination, fmt.Sprintf("page-%0*d%s", digits, index, path.Ext(page)))
+		if err := e.extractEntry(zipReader, page, outputPath); err != nil {
+			return nil, err
+		}
+
+		extractedFiles = append(extractedFiles, extractedFile{path: outputPath, name: filepath.Base(outputPath)})
+	}
+
+	return e.renameFiles(destination, extractedFiles)
+}
+
+// readPackage parses the OPF package and resolves the spine to page images in reading order
+func (e *EpubTool) readPackage(zipReader *zip.Reader) (*opfPackage, []string, error) {
+	var container epubContainer
+	if err := e.decodeXml(zipReader, epubContainerPath, &container); err != nil {
+		return nil, nil, err
+	}
+
+	if len(container.RootFiles) == 0 {
+		return nil, nil, fmt.Errorf("no package document in %v", e.fileName)
+	}
+
+	packagePath := container.RootFiles[0].FullPath
+	var pkg opfPackage
+	if err := e.decodeXml(zipReader, packagePath, &pkg); err != nil {
+		return nil, nil, err
+	}
+
+	manifest := make(map[string]opfItem, len(pkg.Manifest))
+	for _, item := range pkg.Manifest {
+		manifest[item.ID] = item
+	}
+
+	var pages []string
+	for _, itemRef := range pkg.Spine {
+		item, ok := manifest[itemRef.IdRef]
+		if !ok {
+			continue
+		}
+
+		itemPath := e.resolveHref(packagePath, item.Href)
+		if strings.HasPrefix(item.MediaType, "image/") {
+			pages = append(pages, itemPath)
+			continue
+		}
+
+		image, err := e.findPageImage(zipReader, itemPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		if image != "" {
+			pages = append(pages, image)
+		}
+	}
+
+	if len(pages) == 0 {
+		return nil, nil, fmt.Errorf("no page images in spine of %v", e.fileName)
+	}
+
+	return &pkg, pages, nil
+}
+
+// resolveCollection reads the series from belongs-to-collection, falling back to calibre's EPUB 2 metadata
+func (e *EpubTool) resolveCollection(metas []opfMeta) (string, string) {
+	for _, meta := range metas {
+		if meta.Property != "belongs-to-collection" {
+			continue
+		}
+
+		collectionType := ""
+		position := ""
+		for _, refinement := range metas {
+			if meta.ID == "" || refinement.Refines != "#"+meta.ID {
+				continue
+			}
+			switch refinement.Property {
+			case "collection-type":
+				collectionType = strings.TrimSpace(refinement.Value)
+			case "group-position":
+				position = strings.TrimSpace(refinement.Value)
+			}
+		}
+
+		if collectionType == "" || collectionType == "series" {
+			return strings.TrimSpace(meta.Value), position
+		}
+	}
+
+	seriesName := ""
+	position := ""
+	for _, meta := range metas {
+		switch meta.Name {
+		case "calibre:series":
+			seriesName = strings.TrimSpace(meta.Content)
+		case "calibre:series_index":
+			position = strings.TrimSpace(meta.Content)
+		}
+	}
+
+	return seriesName, position
+}
+
+// findPageImage returns the first <img> or SVG <image> referenced by a fixed-layout XHTML page
+func (e *EpubTool) findPageImage(zipReader *zip.Reader, pagePath string) (string, error) {
+	content, err := e.readEntry(zipReader, pagePath)
+	if err != nil {
+		return "", err
+	}
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(content))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			if tokenizer.Err() == io.EOF {
+				return "", nil
+			}
+			return "", fmt.Errorf("failed to parse page %s: %v", pagePath, tokenizer.Err())
+		}
+
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+
+		token := tokenizer.Token()
+		for _, attribute := range token.Attr {
+			isImgSource := token.Data == "img" && attribute.Key == "src"
+			isSvgHref := token.Data == "image" && (attribute.Key == "href" || attribute.Key == "xlink:href")
+			if isImgSource || isSvgHref {
+				return e.resolveHref(pagePath, attribute.Val), nil
+			}
+		}
+	}
+}
+
+func (e *EpubTool) resolveHref(base string, href string) string {
+	href, _, _ = strings.Cut(href, "#")
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+
+	return path.Join(path.Dir(base), href)
+}
+
+func (e *EpubTool) decodeXml(zipReader *zip.Reader, name string, target any) error {
+	content, err := e.readEntry(zipReader, name)
+	if err != nil {
+		return err
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.CharsetReader = charset.NewReaderLabel
+	if err := decoder.Decode(target); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", name, err)
+	}
+
+	return nil
+}
+
+func (e *EpubTool) readEntry(zipReader *zip.Reader, name string) ([]byte, error) {
+	entry, err := zipReader.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", name, err)
+	}
+	defer utils.HandleClose(entry.Close)
+
+	return io.ReadAll(entry)
+}
+
+func (e *EpubTool) extractEntry(zipReader *zip.Reader, name string, outputPath string) error {
+	entry, err := zipReader.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", name, err)
+	}
+	defer utils.HandleClose(entry.Close)
+
+	outputFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file %s: %v", outputPath, err)
+	}
+	defer utils.HandleClose(outputFile.Close)
+
+	if _, err := io.Copy(outputFile, entry); err != nil {
+		return fmt.Errorf("failed to extract file %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// stripMarkup turns an HTML description, which EPUB allows in dc:description, into plain text
+func (e *EpubTool) stripMarkup(description string) string {
+	if !strings.Contains(description, "<") {
+		return description
+	}
+
+	var text strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(description))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return strings.TrimSpace(text.String())
+		case html.TextToken:
+			text.Write(tokenizer.Text())
+		}
+	}
+}
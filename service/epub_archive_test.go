@@ -0,0 +1,46 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEpubToolGetMetaFromPackage(t *testing.T) {
+	file, size := openFixture(t, "fixed-layout.epub")
+
+	meta, err := NewEpubTool("asterix-03.epub").GetMeta(file, size)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Asterix", meta.SeriesName)
+	assert.Equal(t, "3", meta.Number)
+	assert.Equal(t, "Hachette", meta.Publisher)
+	assert.Equal(t, "Asterix and Obelix cross the Rhine.", meta.Summary)
+	assert.Equal(t, 3, meta.PagesCount)
+}
+
+func TestEpubToolExtractsSpineImagesInReadingOrder(t *testing.T) {
+	file, _ := openFixture(t, "fixed-layout.epub")
+	destination := t.TempDir()
+
+	pages, err := NewEpubTool("asterix-03.epub").Extract(file, destination)
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(destination)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Len(t, pages, 3)
+
+	// Fixture pages are solid red, green and blue in spine order
+	expected := []string{"z-cover.png", "a page.png", "m-page.png"}
+	for index, entry := range entries {
+		extracted, err := os.ReadFile(filepath.Join(destination, entry.Name()))
+		require.NoError(t, err)
+
+		original := readZipEntry(t, "fixed-layout.epub", "OEBPS/images/"+expected[index])
+		assert.Equal(t, original, extracted, entry.Name())
+	}
+}
@@ -0,0 +1,14 @@
+package service
+
+import "errors"
+
+var (
+	ErrItemNotFound    = errors.New("purgatory item not found")
+	ErrAlreadyApproved = errors.New("purgatory item is already approved")
+	ErrInvalidSort     = errors.New("invalid sort parameter")
+	ErrPageNotFound    = errors.New("page not found")
+	ErrVersionMismatch = errors.New("purgatory item was modified concurrently")
+	ErrInvalidMeta     = errors.New("invalid meta")
+	ErrJobNotFound     = errors.New("job not found")
+	ErrUnsupportedFile = errors.New("unsupported file")
+)
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// parsedFileName is what a scene style comic file name tells about the issue, e.g.
+// "Saga #054 (2018) (Digital) (Zone-Empire).cbr" or "[Group] X-Men v2 001 (Variant).cbz"
+type parsedFileName struct {
+	Series string
+	Volume string
+	// Issue is normalized: "054" becomes "54" and "½" becomes "0.5", letters are kept
+	Issue string
+	Year  int
+	// Tags are the parenthesized and bracketed groups except year, scanner group and variant
+	Tags      []string
+	ScanGroup string
+	Variant   string
+}
+
+var (
+	bracketGroupRegex = regexp.MustCompile(`[(\[{]([^)\]}]*)[)\]}]`)
+	yearRegex         = regexp.MustCompile(`^(?:19|20)\d{2}(?:-\d{2}(?:-\d{2})?)?$`)
+	volumeRegex       = regexp.MustCompile(`(?i)(?:^|\s)(?:v|vol\.?|volume)\s?(\d+)(?:\s|$)`)
+	issueCountRegex   = regexp.MustCompile(`(?i)\s+of\s+\d+\s*$`)
+	variantRegex      = regexp.MustCompile(`(?i)\bvariant\b|\bvar\b|\bcover [a-z]\b|\bvirgin\b|\bsketch\b|\bincentive\b|\b1:\d+\b`)
+	// issueTokenRegex matches "54", "054", "0.5", "½", "1½", "-1", "54b" and the like
+	issueTokenRegex = regexp.MustCompile(`^#?(-?)(\d*)(½|\.\d+)?([a-zA-Z]{0,2})$`)
+	// decimalDotRegex finds dots between digits, which are decimal points only before a fraction
+	// like the "5" of "0.5", not before a year like in "Batman.001.2016"
+	decimalDotRegex = regexp.MustCompile(`\d\.\d+`)
+)
+
+// descriptiveTags are tags every release group uses, so they never name the scanner
+var descriptiveTags = map[string]bool{
+	"digital": true, "webrip": true, "web": true, "c2c": true, "f": true, "hd": true, "hq": true,
+	"fixed": true, "repack": true, "scan": true, "complete": true, "oneshot": true, "one-shot": true,
+	"tpb": true, "gn": true, "ogn": true, "hc": true, "omnibus": true, "annual": true, "color": true,
+	"colour": true, "b&w": true, "noads": true, "no ads": true, "dcp": true,
+}
+
+// archiveExtensions are stripped from names, other dots may belong to issue numbers like "0.5"
+var archiveExtensions = map[string]bool{
+	".cbz": true, ".cbr": true, ".cb7": true, ".cbt": true, ".zip": true, ".rar": true, ".7z": true,
+	".tar": true, ".pdf": true, ".epub": true, ".jpg": true, ".jpeg": true, ".png": true,
+	".gif": true, ".webp": true, ".bmp": true, ".tif": true, ".tiff": true, ".avif": true, ".jxl": true,
+}
+
+func parseFileName(name string) parsedFileName {
+	result := parsedFileName{}
+
+	name = normalizeName(filepath.Base(name))
+	if archiveExtensions[strings.ToLower(filepath.Ext(name))] {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	name = normalizeSeparators(name)
+
+	// Groups are taken out first, so nothing inside them is mistaken for series or issue
+	groups := bracketGroupRegex.FindAllStringSubmatchIndex(name, -1)
+	var text strings.Builder
+	previous := 0
+	for index, group := range groups {
+		text.WriteString(name[previous:group[0]])
+		text.WriteString(" ")
+		previous = group[1]
+
+		content := strings.TrimSpace(name[group[2]:group[3]])
+		isLeading := strings.TrimSpace(name[:group[0]]) == ""
+		isLast := index == len(groups)-1
+
+		switch {
+		case content == "" || issueCountRegex.MatchString(" "+content):
+			// "(of 66)" counts the issues of a limited series
+		case result.Year == 0 && yearRegex.MatchString(content):
+			result.Year, _ = strconv.Atoi(content[:4])
+		case variantRegex.MatchString(content):
+			result.Variant = content
+		case name[group[0]] == '[' && isLeading && result.ScanGroup == "":
+			// Manga and fansub style "[Group] Title 01"
+			result.ScanGroup = content
+		case isLast && result.ScanGroup == "" && !descriptiveTags[strings.ToLower(content)] && !yearRegex.MatchString(content) && len(groups) > 1:
+			result.ScanGroup = content
+		default:
+			result.Tags = append(result.Tags, content)
+		}
+	}
+	text.WriteString(name[previous:])
+
+	rest := strings.Join(strings.Fields(text.String()), " ")
+	rest = issueCountRegex.ReplaceAllString(rest, "")
+
+	if match := volumeRegex.FindStringSubmatchIndex(rest); match != nil {
+		result.Volume = strings.TrimLeft(rest[match[2]:match[3]], "0")
+		if result.Volume == "" {
+			result.Volume = "0"
+		}
+		rest = strings.TrimSpace(rest[:match[0]] + " " + rest[match[1]:])
+	}
+
+	// A bare year right after the issue is the release year, like in "Batman.001.2016"
+	if words := strings.Fields(rest); result.Year == 0 && len(words) > 2 &&
+		yearRegex.MatchString(words[len(words)-1]) && isIssueToken(words[len(words)-2]) {
+		result.Year, _ = strconv.Atoi(words[len(words)-1][:4])
+		rest = strings.Join(words[:len(words)-1], " ")
+	}
+
+	result.Series, result.Issue = splitIssue(rest)
+	if result.Issue == "" {
+		result.Series = trimSeparators(rest)
+	}
+
+	return result
+}
+
+// splitIssue finds the issue token, preferring one marked with "#" and otherwise the last
+// number that isn't the first word, and returns the series name in front of it
+func splitIssue(text string) (string, string) {
+	words := strings.Fields(text)
+
+	candidate := -1
+	for index := len(words) - 1; index > 0; index-- {
+		if !isIssueToken(words[index]) {
+			continue
+		}
+		if strings.HasPrefix(words[index], "#") {
+			candidate = index
+			break
+		}
+		if candidate == -1 {
+			candidate = index
+		}
+	}
+
+	// A leading "#12" is an issue even without a series in front
+	if candidate == -1 && len(words) > 0 && strings.HasPrefix(words[0], "#") && isIssueToken(words[0]) {
+		candidate = 0
+	}
+
+	if candidate == -1 {
+		return "", ""
+	}
+
+	series := trimSeparators(strings.Join(words[:candidate], " "))
+	return series, normalizeIssue(words[candidate])
+}
+
+func isIssueToken(word string) bool {
+	match := issueTokenRegex.FindStringSubmatch(word)
+	if match == nil {
+		return false
+	}
+
+	digits, fraction, letters := match[2], match[3], match[4]
+	if digits == "" && fraction != "½" {
+		return false
+	}
+	// "v2" or "c2c" are no issues, a letter suffix is only allowed after digits
+	if letters != "" && (digits == "" || fraction != "") {
+		return false
+	}
+	// A bare year is rather part of the series, like "Spider-Man 2099"
+	if match[1] == "" && fraction == "" && letters == "" && !strings.HasPrefix(word, "#") && len(digits) == 4 && yearRegex.MatchString(digits) {
+		return false
+	}
+
+	return true
+}
+
+// normalizeIssue drops padding and spells fractions as decimals, so issues compare and sort
+func normalizeIssue(word string) string {
+	match := issueTokenRegex.FindStringSubmatch(word)
+	if match == nil {
+		return strings.TrimSpace(word)
+	}
+
+	sign, digits, fraction, letters := match[1], match[2], match[3], match[4]
+
+	digits = strings.TrimLeft(digits, "0")
+	switch {
+	case fraction == "½":
+		if digits == "" {
+			digits = "0"
+		}
+		fraction = ".5"
+	case digits == "":
+		digits = "0"
+	}
+
+	if fraction != "" {
+		fraction = strings.TrimRight(fraction, "0")
+		if fraction == "." {
+			fraction = ""
+		}
+	}
+
+	return sign + digits + fraction + letters
+}
+
+// normalizeSeparators turns underscores and dots into spaces. Names without spaces also
+// use hyphens as separators, but only in front of numbers, to keep "X-Men" intact.
+func normalizeSeparators(name string) string {
+	name = strings.ReplaceAll(name, "_", " ")
+	name = decimalDotRegex.ReplaceAllStringFunc(name, func(match string) string {
+		if _, fraction, _ := strings.Cut(match, "."); len(fraction) > 2 {
+			return match
+		}
+		return strings.Replace(match, ".", "\x00", 1)
+	})
+	name = strings.ReplaceAll(name, ".", " ")
+	name = strings.ReplaceAll(name, "\x00", ".")
+
+	if !strings.Contains(strings.TrimSpace(name), " ") {
+		var normalized strings.Builder
+		runes := []rune(name)
+		for index, char := range runes {
+			if char == '-' && index > 0 && index+1 < len(runes) && unicode.IsDigit(runes[index+1]) {
+				normalized.WriteRune(' ')
+				continue
+			}
+			normalized.WriteRune(char)
+		}
+		name = normalized.String()
+	}
+
+	return name
+}
+
+func trimSeparators(value string) string {
+	return strings.TrimFunc(value, func(char rune) bool {
+		return unicode.IsSpace(char) || char == '-' || char == '#' || char == ':' || char == ',' || char == '–' || char == '—'
+	})
+}
+
+// normalizeName brings a name to the form it is stored in: composed characters, as macOS
+// file names come decomposed, and fullwidth latin and digits as plain ASCII, so "Ｓａｇａ ０５４"
+// parses like "Saga 054"
+func normalizeName(name string) string {
+	return norm.NFC.String(width.Fold.String(name))
+}
+
+// foldName is the key names are compared by, ignoring case and width as well as spacing
+func foldName(name string) string {
+	return strings.Join(strings.Fields(cases.Fold().String(normalizeName(name))), " ")
+}
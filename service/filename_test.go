@@ -0,0 +1,229 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFileName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected parsedFileName
+	}{
+		// Plain names
+		{"Saga 054.cbz", parsedFileName{Series: "Saga", Issue: "54"}},
+		{"Saga 54.cbr", parsedFileName{Series: "Saga", Issue: "54"}},
+		{"saga-054.cbz", parsedFileName{Series: "saga", Issue: "54"}},
+		{"bone-07.cbt", parsedFileName{Series: "bone", Issue: "7"}},
+		{"Saga_054.cbz", parsedFileName{Series: "Saga", Issue: "54"}},
+		{"Saga.054.cbz", parsedFileName{Series: "Saga", Issue: "54"}},
+		{"Batman.001.2016.cbz", parsedFileName{Series: "Batman", Issue: "1", Year: 2016}},
+		{"The Walking Dead 193.cbz", parsedFileName{Series: "The Walking Dead", Issue: "193"}},
+		{"One Piece 1089.cbz", parsedFileName{Series: "One Piece", Issue: "1089"}},
+		{"Saga.cbz", parsedFileName{Series: "Saga"}},
+		{"054.cbz", parsedFileName{Series: "054"}},
+		{"", parsedFileName{}},
+
+		// Issue markers and numbering
+		{"Saga #054.cbz", parsedFileName{Series: "Saga", Issue: "54"}},
+		{"Saga #54 (of 66).cbz", parsedFileName{Series: "Saga", Issue: "54"}},
+		{"Saga 054 of 066.cbz", parsedFileName{Series: "Saga", Issue: "54"}},
+		{"#12.cbz", parsedFileName{Issue: "12"}},
+		{"Batman 0.5.cbz", parsedFileName{Series: "Batman", Issue: "0.5"}},
+		{"Batman 1.50.cbz", parsedFileName{Series: "Batman", Issue: "1.5"}},
+		{"Wolverine ½.cbz", parsedFileName{Series: "Wolverine", Issue: "0.5"}},
+		{"Wolverine 1½.cbz", parsedFileName{Series: "Wolverine", Issue: "1.5"}},
+		{"Uncanny X-Men -1.cbz", parsedFileName{Series: "Uncanny X-Men", Issue: "-1"}},
+		{"Uncanny X-Men #-1.cbz", parsedFileName{Series: "Uncanny X-Men", Issue: "-1"}},
+		{"Saga 054b.cbz", parsedFileName{Series: "Saga", Issue: "54b"}},
+		{"Action Comics 000.cbz", parsedFileName{Series: "Action Comics", Issue: "0"}},
+		{"Batman Annual 2.cbz", parsedFileName{Series: "Batman Annual", Issue: "2"}},
+		{"100 Bullets 042.cbz", parsedFileName{Series: "100 Bullets", Issue: "42"}},
+		{"2000 AD 2345.cbz", parsedFileName{Series: "2000 AD", Issue: "2345"}},
+		{"Spider-Man 2099 001.cbz", parsedFileName{Series: "Spider-Man 2099", Issue: "1"}},
+		{"Spider-Man 2099.cbz", parsedFileName{Series: "Spider-Man 2099"}},
+		{"Batman 2016.cbz", parsedFileName{Series: "Batman 2016"}},
+
+		// Volumes
+		{"X-Men v2 001.cbz", parsedFileName{Series: "X-Men", Volume: "2", Issue: "1"}},
+		{"X-Men Vol. 2 001.cbz", parsedFileName{Series: "X-Men", Volume: "2", Issue: "1"}},
+		{"X-Men Vol 02 #001.cbz", parsedFileName{Series: "X-Men", Volume: "2", Issue: "1"}},
+		{"X-Men Volume 2 001.cbz", parsedFileName{Series: "X-Men", Volume: "2", Issue: "1"}},
+		{"Bone v01.cbz", parsedFileName{Series: "Bone", Volume: "1"}},
+
+		// Years, tags and scanners
+		{"Saga #054 (2018) (Digital) (Zone-Empire).cbr", parsedFileName{
+			Series: "Saga", Issue: "54", Year: 2018, Tags: []string{"Digital"}, ScanGroup: "Zone-Empire",
+		}},
+		{"Saga 054 (2018).cbz", parsedFileName{Series: "Saga", Issue: "54", Year: 2018}},
+		{"Saga 054 (2018-06-27).cbz", parsedFileName{Series: "Saga", Issue: "54", Year: 2018}},
+		{"Saga 054 (Digital).cbz", parsedFileName{Series: "Saga", Issue: "54", Tags: []string{"Digital"}}},
+		{"Saga 054 (2018) (Digital).cbz", parsedFileName{Series: "Saga", Issue: "54", Year: 2018, Tags: []string{"Digital"}}},
+		{"Batman 001 (2016) (GreenGiant-DCP).cbr", parsedFileName{Series: "Batman", Issue: "1", Year: 2016, ScanGroup: "GreenGiant-DCP"}},
+		{"Batman 001 (2016) (Webrip) (The Last Kryptonian-DCP).cbr", parsedFileName{
+			Series: "Batman", Issue: "1", Year: 2016, Tags: []string{"Webrip"}, ScanGroup: "The Last Kryptonian-DCP",
+		}},
+		{"Saga 054 (2018) (c2c).cbz", parsedFileName{Series: "Saga", Issue: "54", Year: 2018, Tags: []string{"c2c"}}},
+		{"Saga (2012) 054.cbz", parsedFileName{Series: "Saga", Issue: "54", Year: 2012}},
+		{"Saga 054 [2018].cbz", parsedFileName{Series: "Saga", Issue: "54", Year: 2018}},
+		{"Saga 054 (1999) (2018).cbz", parsedFileName{Series: "Saga", Issue: "54", Year: 1999, Tags: []string{"2018"}}},
+		{"Saga 054 ().cbz", parsedFileName{Series: "Saga", Issue: "54"}},
+
+		// Manga and fansub style
+		{"[Group] Title - 01.cbz", parsedFileName{Series: "Title", Issue: "1", ScanGroup: "Group"}},
+		{"[Group] Title - 01 [1080p].cbz", parsedFileName{Series: "Title", Issue: "1", Tags: []string{"1080p"}, ScanGroup: "Group"}},
+		{"[Group]_Long_Title_-_012.cbz", parsedFileName{Series: "Long Title", Issue: "12", ScanGroup: "Group"}},
+		{"Title - 01 [Group].cbz", parsedFileName{Series: "Title", Issue: "1", Tags: []string{"Group"}}},
+
+		// Variants
+		{"X-Men v2 001 (Variant).cbz", parsedFileName{Series: "X-Men", Volume: "2", Issue: "1", Variant: "Variant"}},
+		{"Saga 001 (Cover B) (2012).cbz", parsedFileName{Series: "Saga", Issue: "1", Year: 2012, Variant: "Cover B"}},
+		{"Saga 001 (1:25 Incentive).cbz", parsedFileName{Series: "Saga", Issue: "1", Variant: "1:25 Incentive"}},
+		{"Saga 001 (Virgin Var).cbz", parsedFileName{Series: "Saga", Issue: "1", Variant: "Virgin Var"}},
+		{"Saga 001 (Sketch Cover) (2012) (Digital) (Zone).cbz", parsedFileName{
+			Series: "Saga", Issue: "1", Year: 2012, Tags: []string{"Digital"}, ScanGroup: "Zone", Variant: "Sketch Cover",
+		}},
+
+		// Non-Latin titles
+		{"進撃の巨人 139.cbz", parsedFileName{Series: "進撃の巨人", Issue: "139"}},
+		{"ワンピース 第1089話.cbz", parsedFileName{Series: "ワンピース 第1089話"}},
+		{"Чорний Кіт 012.cbz", parsedFileName{Series: "Чорний Кіт", Issue: "12"}},
+		{"Astérix 03 (1963).cbz", parsedFileName{Series: "Astérix", Issue: "3", Year: 1963}},
+		{"나 혼자만 레벨업 110.cbz", parsedFileName{Series: "나 혼자만 레벨업", Issue: "110"}},
+
+		// Punctuation and paths
+		{"Batman: Year One 001.cbz", parsedFileName{Series: "Batman: Year One", Issue: "1"}},
+		{"Mr. Miracle 01.cbz", parsedFileName{Series: "Mr Miracle", Issue: "1"}},
+		{"comics/Saga/Saga 054.cbz", parsedFileName{Series: "Saga", Issue: "54"}},
+		{"Saga - 054.cbz", parsedFileName{Series: "Saga", Issue: "54"}},
+		{"Saga 054 .cbz", parsedFileName{Series: "Saga", Issue: "54"}},
+		{"Saga 054.CBZ", parsedFileName{Series: "Saga", Issue: "54"}},
+		{"Saga 054.jpg", parsedFileName{Series: "Saga", Issue: "54"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, parseFileName(test.name))
+		})
+	}
+}
+
+func TestNormalizeIssue(t *testing.T) {
+	tests := []struct {
+		issue    string
+		expected string
+	}{
+		{"054", "54"},
+		{"0", "0"},
+		{"000", "0"},
+		{"#12", "12"},
+		{"0.5", "0.5"},
+		{".5", "0.5"},
+		{"1.50", "1.5"},
+		{"2.0", "2"},
+		{"½", "0.5"},
+		{"1½", "1.5"},
+		{"-1", "-1"},
+		{"054b", "54b"},
+		{"12AU", "12AU"},
+		{"Fifty", "Fifty"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.issue, func(t *testing.T) {
+			assert.Equal(t, test.expected, normalizeIssue(test.issue))
+		})
+	}
+}
+
+func TestNormalizeNumber(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"54", "54"},
+		{" 054 ", "54"},
+		{"2018", "2018"},
+		{"½", "0.5"},
+		{"-1", "-1"},
+		{"54 (of 66)", "54"},
+		{"Issue 54", "54"},
+		{"Chapter Fifty-Four", ""},
+		{"", ""},
+	}
+
+	tool := baseArchiveTool{}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			assert.Equal(t, test.expected, tool.normalizeNumber(test.value))
+		})
+	}
+}
+
+func TestParseFileNameUnicode(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected parsedFileName
+	}{
+		// Decomposed "é", as macOS writes file names
+		{"Aste\u0301rix 03.cbz", parsedFileName{Series: "Astérix", Issue: "3"}},
+		{"Ｓａｇａ ０５４.cbz", parsedFileName{Series: "Saga", Issue: "54"}},
+		{"ﾜﾝﾋﾟｰｽ 1089.cbz", parsedFileName{Series: "ワンピース", Issue: "1089"}},
+		{"Wiedźmin 02 (2018).cbz", parsedFileName{Series: "Wiedźmin", Issue: "2", Year: 2018}},
+		{"Żółć_i_Gęś_-_07.cbz", parsedFileName{Series: "Żółć i Gęś", Issue: "7"}},
+		{"Les_Mémoires_de_l'Élève_012.cbz", parsedFileName{Series: "Les Mémoires de l'Élève", Issue: "12"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, parseFileName(test.name))
+		})
+	}
+}
+
+func TestFoldName(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"Astérix", "Aste\u0301rix"},
+		{"ASTÉRIX", "astérix"},
+		{"Saga", "Ｓａｇａ"},
+		{"ワンピース", "ﾜﾝﾋﾟｰｽ"},
+		{"Straße", "STRASSE"},
+		{"ŻÓŁĆ", "żółć"},
+		{"Bone  One", " bone one "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.a, func(t *testing.T) {
+			assert.Equal(t, foldName(test.a), foldName(test.b))
+		})
+	}
+
+	assert.NotEqual(t, foldName("Astérix"), foldName("Asterix"))
+}
+
+func TestCrossNames(t *testing.T) {
+	tests := []struct {
+		name1, name2 string
+		expected     string
+	}{
+		{"Saga 054.cbz", "saga 054 01.jpg", "Saga 054"},
+		{"Astérix 03.cbz", "aste\u0301rix 03 p1.jpg", "Astérix 03"},
+		{"Astérix 03.cbz", "Asterix 03 p1.jpg", "Ast"},
+		{"Aste\u0301rix.cbz", "Astérix 01.jpg", "Astérix"},
+		{"進撃の巨人.cbz", "進撃の巨人 01.jpg", "進撃の巨人"},
+		{"進撃の巨人.cbz", "進撃の小人.jpg", "進撃の"},
+		{"Gęś.cbz", "gęś 01.jpg", "Gęś"},
+		{"Ｓａｇａ.cbz", "saga 01.jpg", "Saga"},
+		{"054.cbz", "page01.jpg", ""},
+	}
+
+	tool := baseArchiveTool{}
+	for _, test := range tests {
+		t.Run(test.name1+" "+test.name2, func(t *testing.T) {
+			assert.Equal(t, test.expected, tool.crossNames(test.name1, test.name2))
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"paper/purgatory/dto"
+	"paper/purgatory/utils"
+	"path/filepath"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// formatExtensions maps detected image formats to the extension their page files get
+var formatExtensions = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+	"gif":  ".gif",
+	"webp": ".webp",
+	"bmp":  ".bmp",
+	"tiff": ".tiff",
+	"avif": ".avif",
+	"jxl":  ".jxl",
+	"jp2":  ".jp2",
+	"j2k":  ".j2k",
+}
+
+// sniffImageFormat identifies an image by its magic bytes, returning "" for anything else
+func sniffImageFormat(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xff, 0xd8, 0xff}):
+		return "jpeg"
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return "gif"
+	case len(header) >= 12 && bytes.Equal(header[:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WEBP")):
+		return "webp"
+	case bytes.HasPrefix(header, []byte("BM")):
+		return "bmp"
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		return "tiff"
+	case len(header) >= 12 && bytes.Equal(header[4:8], []byte("ftyp")) &&
+		(bytes.Equal(header[8:12], []byte("avif")) || bytes.Equal(header[8:12], []byte("avis"))):
+		return "avif"
+	case bytes.HasPrefix(header, []byte{0xff, 0x0a}), bytes.HasPrefix(header, []byte("\x00\x00\x00\x0cJXL \r\n\x87\n")):
+		return "jxl"
+	case bytes.HasPrefix(header, []byte("\x00\x00\x00\x0cjP  \r\n\x87\n")):
+		return "jp2"
+	case bytes.HasPrefix(header, []byte{0xff, 0x4f, 0xff, 0x51}):
+		// Raw JPEG 2000 codestream, as PDFs often embed it
+		return "j2k"
+	}
+	return ""
+}
+
+func detectImageFormat(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer utils.HandleClose(file.Close)
+
+	header := make([]byte, 16)
+	read, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	return sniffImageFormat(header[:read]), nil
+}
+
+func readPageFile(index int, path string) (dto.PageFile, error) {
+	page := dto.PageFile{Index: index, Name: filepath.Base(path)}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return page, err
+	}
+	defer utils.HandleClose(file.Close)
+
+	stat, err := file.Stat()
+	if err != nil {
+		return page, err
+	}
+	page.Size = stat.Size()
+
+	// Pages that can't be decoded are still listed, just without format and dimensions
+	config, format, err := image.DecodeConfig(file)
+	if err == nil {
+		page.Format = format
+		page.Width = config.Width
+		page.Height = config.Height
+	}
+
+	return page, nil
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"paper/purgatory/model"
+	"paper/purgatory/utils"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	uploadsDirectory = "uploads"
+	jobPollInterval  = 10 * time.Second
+)
+
+type jobService struct {
+	database    *gorm.DB
+	purgatory   PurgatoryService
+	uploadsPath string
+	workers     int
+	wakeup      chan struct{}
+}
+
+type JobService interface {
+	Submit(source *multipart.FileHeader) (*model.Job, error)
+
+	SubmitBatch(pages []*multipart.FileHeader, name string, order string) (*model.Job, error)
+
+	Get(id string) (*model.Job, error)
+
+	Start() error
+}
+
+func InitJobService(database *gorm.DB, purgatory PurgatoryService, filesPath string, workers int) JobService {
+	return &jobService{
+		database:    database,
+		purgatory:   purgatory,
+		uploadsPath: filepath.Join(filesPath, uploadsDirectory),
+		workers:     workers,
+		wakeup:      make(chan struct{}, workers),
+	}
+}
+
+func (s *jobService) Submit(source *multipart.FileHeader) (*model.Job, error) {
+	job := model.Job{
+		ID:       uuid.NewString(),
+		FileName: source.Filename,
+		State:    model.JobQueued,
+	}
+	job.Path = filepath.Join(s.uploadsPath, job.ID+filepath.Ext(source.Filename))
+
+	if err := s.storeUpload(source, job.Path); err != nil {
+		return nil, err
+	}
+
+	return s.enqueue(&job)
+}
+
+// SubmitBatch queues loose page images as one issue, packed into a cbz in the given page order
+func (s *jobService) SubmitBatch(pages []*multipart.FileHeader, name string, order string) (*model.Job, error) {
+	for _, page := range pages {
+		if !isImageFile(page.Filename) {
+			return nil, fmt.Errorf("%w: %s is not an image", ErrUnsupportedFile, page.Filename)
+		}
+	}
+
+	if name == "" {
+		name = batchName(pages)
+	}
+
+	job := model.Job{
+		ID:       uuid.NewString(),
+		FileName: name + ".cbz",
+		State:    model.JobQueued,
+	}
+	job.Path = filepath.Join(s.uploadsPath, job.ID+".cbz")
+
+	if err := packImages(pages, order, job.Path); err != nil {
+		return nil, err
+	}
+
+	return s.enqueue(&job)
+}
+
+func (s *jobService) enqueue(job *model.Job) (*model.Job, error) {
+	if err := s.database.Create(job).Error; err != nil {
+		utils.HandleRemove(os.Remove, job.Path)
+		return nil, err
+	}
+
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+		// Every worker is busy already and will pick the job up from the database
+	}
+
+	return job, nil
+}
+
+func (s *jobService) Get(id string) (*model.Job, error) {
+	job := model.Job{}
+	err := s.database.Take(&job, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// Start requeues jobs interrupted by a restart and launches the worker pool
+func (s *jobService) Start() error {
+	if err := os.MkdirAll(s.uploadsPath, 0755); err != nil {
+		return fmt.Errorf("failed to create uploads directory: %v", err)
+	}
+
+	var interrupted []model.Job
+	if err := s.database.Where("state = ? and item_id is not null", model.JobExtracting).Find(&interrupted).Error; err != nil {
+		return fmt.Errorf("failed to find interrupted jobs: %v", err)
+	}
+
+	// The retry creates its own item, the one left half extracted would linger forever
+	for _, job := range interrupted {
+		if err := s.purgatory.DiscardUnfinished(*job.ItemID); err != nil {
+			return fmt.Errorf("failed to discard item of interrupted job %s: %v", job.ID, err)
+		}
+	}
+
+	err := s.database.Model(&model.Job{}).
+		Where("state = ?", model.JobExtracting).
+		Updates(map[string]any{"state": model.JobQueued, "progress": 0, "item_id": nil}).Error
+	if err != nil {
+		return fmt.Errorf("failed to requeue interrupted jobs: %v", err)
+	}
+
+	for range s.workers {
+		go s.work()
+	}
+
+	return nil
+}
+
+func (s *jobService) work() {
+	for {
+		job, err := s.claim()
+		if err != nil {
+			fmt.Println("failed to claim job:", err)
+		}
+
+		if job == nil {
+			select {
+			case <-s.wakeup:
+			case <-time.After(jobPollInterval):
+			}
+			continue
+		}
+
+		s.process(job)
+	}
+}
+
+// claim moves the oldest queued job to extracting, skipping jobs locked by other workers
+func (s *jobService) claim() (*model.Job, error) {
+	var job *model.Job
+	err := s.database.Transaction(func(tx *gorm.DB) error {
+		var queued []model.Job
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("state = ?", model.JobQueued).
+			Order("created_at").
+			Limit(1).
+			Find(&queued).Error
+		if err != nil || len(queued) == 0 {
+			return err
+		}
+
+		job = &queued[0]
+		job.State = model.JobExtracting
+		job.Progress = 0
+
+		return tx.Save(job).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (s *jobService) process(job *model.Job) {
+	defer utils.HandleRemove(os.Remove, job.Path)
+
+	item, err := s.save(job)
+	if err != nil {
+		fmt.Println("job", job.ID, "failed:", err)
+		s.update(job.ID, map[string]any{"state": model.JobFailed, "error": err.Error(), "item_id": nil})
+		return
+	}
+
+	s.update(job.ID, map[string]any{"state": model.JobDone, "progress": 100, "item_id": item.ID})
+}
+
+func (s *jobService) save(job *model.Job) (*model.PurgatoryItem, error) {
+	input, err := os.Open(job.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload: %v", err)
+	}
+	defer utils.HandleClose(input.Close)
+
+	created := func(id int64) {
+		s.update(job.ID, map[string]any{"item_id": id})
+	}
+
+	return s.purgatory.Save(input, job.FileName, created, func(progress int) {
+		s.update(job.ID, map[string]any{"progress": progress})
+	})
+}
+
+func (s *jobService) update(id string, values map[string]any) {
+	err := s.database.Model(&model.Job{}).Where("id = ?", id).Updates(values).Error
+	if err != nil {
+		fmt.Println("failed to update job", id, err)
+	}
+}
+
+func (s *jobService) storeUpload(source *multipart.FileHeader, path string) error {
+	src, err := source.Open()
+	if err != nil {
+		return err
+	}
+	defer utils.HandleClose(src.Close)
+
+	dest, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer utils.HandleClose(dest.Close)
+
+	if _, err := io.Copy(dest, src); err != nil {
+		utils.HandleRemove(os.Remove, path)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"paper/purgatory/model"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Metadata files are tiny, anything bigger is not worth holding in memory
+const maxMetadataSize = 4 << 20
+
+// metadataReader turns one metadata format found inside archives into ArchiveMeta.
+// read returns nil meta for files that only look like the format by name.
+type metadataReader struct {
+	name    string
+	matches func(entryName string) bool
+	read    func(tool *baseArchiveTool, content []byte) (*model.ArchiveMeta, error)
+}
+
+// metadataReaders are ordered by precedence: fields of the first format found win,
+// the others only fill gaps. MetronInfo is what current taggers write, CoMet is rare.
+var metadataReaders = []metadataReader{
+	{name: "MetronInfo", matches: baseNameIs("metroninfo.xml"), read: (*baseArchiveTool).readMetronInfo},
+	{name: "ComicInfo", matches: isComicInfoName, read: (*baseArchiveTool).readComicInfo},
+	{name: "CoMet", matches: isCoMetCandidate, read: (*baseArchiveTool).readCoMet},
+}
+
+// metadataFile is the content of an archive entry some reader is interested in
+type metadataFile struct {
+	name    string
+	content []byte
+}
+
+func isMetadataFile(entryName string) bool {
+	for _, reader := range metadataReaders {
+		if reader.matches(entryName) {
+			return true
+		}
+	}
+	return false
+}
+
+func readMetadataFile(entryName string, reader io.Reader) (metadataFile, error) {
+	content, err := io.ReadAll(io.LimitReader(reader, maxMetadataSize))
+	if err != nil {
+		return metadataFile{}, fmt.Errorf("failed to read %s: %v", entryName, err)
+	}
+	return metadataFile{name: entryName, content: content}, nil
+}
+
+// readMetadata merges every metadata file of the archive by reader precedence.
+// It returns nil when none of them could be read.
+func (b *baseArchiveTool) readMetadata(files []metadataFile) (*model.ArchiveMeta, error) {
+	var meta *model.ArchiveMeta
+	var readErrors []error
+
+	for _, reader := range metadataReaders {
+		for _, file := range files {
+			if !reader.matches(file.name) {
+				continue
+			}
+
+			fileMeta, err := reader.read(b, file.content)
+			if err != nil {
+				readErrors = append(readErrors, fmt.Errorf("%s %s: %v", reader.name, file.name, err))
+				continue
+			}
+			if fileMeta == nil {
+				continue
+			}
+
+			if meta == nil {
+				meta = fileMeta
+			} else {
+				mergeMeta(meta, fileMeta)
+			}
+		}
+	}
+
+	// A broken file only fails the upload when there's nothing else to go by
+	if meta == nil && len(readErrors) > 0 {
+		return nil, errors.Join(readErrors...)
+	}
+	for _, err := range readErrors {
+		fmt.Println("ignoring metadata of", b.fileName, err)
+	}
+
+	return meta, nil
+}
+
+// completeMeta resolves what the metadata files didn't provide from the file name
+func (b *baseArchiveTool) completeMeta(meta *model.ArchiveMeta, descriptors []string) *model.ArchiveMeta {
+	if meta == nil {
+		meta = &model.ArchiveMeta{}
+	}
+
+	if meta.SeriesName == "" {
+		firstPage := descriptors[0]
+		for _, descriptor := range descriptors {
+			if isImageFile(descriptor) {
+				firstPage = descriptor
+				break
+			}
+		}
+		meta.SeriesName = b.resolveSeriesName(firstPage)
+	}
+	if meta.Number == "" {
+		meta.Number = b.resolveNumber(meta.SeriesName)
+	}
+
+	parsed := parseFileName(b.fileName)
+	if meta.Volume == 0 {
+		meta.Volume, _ = strconv.Atoi(parsed.Volume)
+	}
+	if meta.Year == 0 {
+		meta.Year = parsed.Year
+	}
+	if meta.ScanInformation == "" {
+		meta.ScanInformation = parsed.ScanGroup
+	}
+
+	meta.PagesCount = b.countPages(descriptors)
+	return meta
+}
+
+// mergeMeta fills the fields target leaves empty from source, so the richer
+// metadata format keeps precedence and the other one only completes it
+func mergeMeta(target *model.ArchiveMeta, source *model.ArchiveMeta) {
+	targetValue := reflect.ValueOf(target).Elem()
+	sourceValue := reflect.ValueOf(source).Elem()
+
+	for index := range targetValue.NumField() {
+		field := targetValue.Field(index)
+		if field.IsZero() {
+			field.Set(sourceValue.Field(index))
+		}
+	}
+}
+
+func baseNameIs(name string) func(string) bool {
+	return func(entryName string) bool {
+		return strings.EqualFold(path.Base(strings.ReplaceAll(entryName, "\\", "/")), name)
+	}
+}
+
+// isComicInfoName also accepts copies like "ComicInfo (1).xml" that taggers leave behind
+func isComicInfoName(entryName string) bool {
+	name := strings.ToLower(path.Base(strings.ReplaceAll(entryName, "\\", "/")))
+	return strings.HasPrefix(name, "comicinfo") && strings.HasSuffix(name, ".xml")
+}
+
+// isCoMetCandidate matches any other XML file, as CoMet has no fixed file name
+func isCoMetCandidate(entryName string) bool {
+	return strings.EqualFold(path.Ext(entryName), ".xml") &&
+		!isComicInfoName(entryName) &&
+		!baseNameIs("metroninfo.xml")(entryName)
+}
+
+// decodeMetadataXml decodes content if its root element is root. The returned flag tells
+// whether the document is of that format at all, as opposed to being broken.
+func decodeMetadataXml(content []byte, root string, target any) (bool, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false, fmt.Errorf("failed to parse XML: %v", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !strings.EqualFold(start.Name.Local, root) {
+			return false, nil
+		}
+
+		if err := decoder.DecodeElement(target, &start); err != nil {
+			return true, fmt.Errorf("failed to parse XML: %v", err)
+		}
+		return true, nil
+	}
+}
+
+// addCredit files a person under the ComicInfo creator field matching a credited role
+func addCredit(meta *model.ArchiveMeta, role string, person string) {
+	person = strings.TrimSpace(person)
+	if person == "" {
+		return
+	}
+
+	switch strings.ToLower(strings.TrimSpace(role)) {
+	case "writer", "plotter", "plot", "scripter", "script", "story":
+		meta.Writer = appendUnique(meta.Writer, person)
+	case "artist", "illustrator":
+		meta.Penciller = appendUnique(meta.Penciller, person)
+		meta.Inker = appendUnique(meta.Inker, person)
+	case "penciller", "penciler", "breakdowns", "layouts":
+		meta.Penciller = appendUnique(meta.Penciller, person)
+	case "inker", "finishes", "embellisher":
+		meta.Inker = appendUnique(meta.Inker, person)
+	case "colorist", "colourist", "colorer", "colourer", "color separations":
+		meta.Colorist = appendUnique(meta.Colorist, person)
+	case "letterer":
+		meta.Letterer = appendUnique(meta.Letterer, person)
+	case "cover", "covers", "cover artist", "coverartist", "coverdesigner", "cover designer":
+		meta.CoverArtist = appendUnique(meta.CoverArtist, person)
+	case "editor", "editor in chief", "consulting editor", "assistant editor", "associate editor",
+		"group editor", "senior editor", "managing editor", "collection editor", "supervising editor",
+		"executive editor":
+		meta.Editor = appendUnique(meta.Editor, person)
+	case "translator":
+		meta.Translator = appendUnique(meta.Translator, person)
+	}
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"paper/purgatory/model"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const metronInfoXml = `<?xml version="1.0" encoding="UTF-8"?>
+<MetronInfo xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <Publisher id="12">
+    <Name>Image</Name>
+    <Imprint>Skybound</Imprint>
+  </Publisher>
+  <Series lang="en" id="2311">
+    <Name>Saga</Name>
+    <Volume>1</Volume>
+    <Format>Single Issue</Format>
+    <IssueCount>66</IssueCount>
+  </Series>
+  <Number>54</Number>
+  <Stories>
+    <Story>Chapter Fifty-Four</Story>
+  </Stories>
+  <Summary>Hazel goes to school.</Summary>
+  <CoverDate>2018-07-25</CoverDate>
+  <GTIN>
+    <UPC>70985302153605411</UPC>
+  </GTIN>
+  <AgeRating>Mature</AgeRating>
+  <Genres>
+    <Genre id="1">Science Fiction</Genre>
+  </Genres>
+  <Arcs>
+    <Arc id="5"><Name>The War for Phang</Name><Number>3</Number></Arc>
+  </Arcs>
+  <Characters>
+    <Character>Hazel</Character>
+    <Character>Alana</Character>
+  </Characters>
+  <URLs>
+    <URL primary="true">https://metron.cloud/issue/saga-2012-54/</URL>
+  </URLs>
+  <Credits>
+    <Credit>
+      <Creator id="1">Brian K. Vaughan</Creator>
+      <Roles><Role id="1">Writer</Role></Roles>
+    </Credit>
+    <Credit>
+      <Creator id="2">Fiona Staples</Creator>
+      <Roles><Role id="2">Artist</Role><Role id="3">Cover</Role></Roles>
+    </Credit>
+  </Credits>
+</MetronInfo>`
+
+const coMetXml = `<?xml version="1.0" encoding="UTF-8"?>
+<comet xmlns="http://www.denvog.com/comet/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <title>Blacksad: Amarillo</title>
+  <series>Blacksad</series>
+  <issue>5</issue>
+  <publisher>Dark Horse</publisher>
+  <date>2014-06</date>
+  <genre>Noir</genre>
+  <language>en</language>
+  <identifier>isbn:978-1-61655-525-4</identifier>
+  <writer>Juan Díaz Canales</writer>
+  <penciller>Juanjo Guarnido</penciller>
+  <readingDirection>ltr</readingDirection>
+</comet>`
+
+func TestReadMetronInfo(t *testing.T) {
+	meta, err := NewCbzTool("saga-54.cbz").readMetronInfo([]byte(metronInfoXml))
+	require.NoError(t, err)
+
+	assert.Equal(t, &model.ArchiveMeta{
+		SeriesName:     "Saga",
+		Number:         "54",
+		Summary:        "Hazel goes to school.",
+		Publisher:      "Image",
+		Title:          "Chapter Fifty-Four",
+		Volume:         1,
+		Count:          66,
+		Year:           2018,
+		Month:          7,
+		Day:            25,
+		Writer:         []string{"Brian K. Vaughan"},
+		Penciller:      []string{"Fiona Staples"},
+		Inker:          []string{"Fiona Staples"},
+		CoverArtist:    []string{"Fiona Staples"},
+		Imprint:        "Skybound",
+		Genre:          []string{"Science Fiction"},
+		Web:            []string{"https://metron.cloud/issue/saga-2012-54/"},
+		LanguageISO:    "en",
+		Format:         "Single Issue",
+		AgeRating:      "Mature 17+",
+		StoryArc:       "The War for Phang",
+		StoryArcNumber: "3",
+		// The fixture's UPC has 17 digits, which would fail every later edit of the item
+		GTIN:       "",
+		Characters: []string{"Hazel", "Alana"},
+	}, meta)
+}
+
+func TestReadMetronInfoCutsLongTitles(t *testing.T) {
+	stories := strings.Repeat("<Story>"+strings.Repeat("a", 60)+"</Story>", 5)
+	meta, err := NewCbzTool("saga-54.cbz").readMetronInfo([]byte(`<MetronInfo>
+  <Series lang="English"><Name>Saga</Name></Series>
+  <Stories>` + stories + `</Stories>
+</MetronInfo>`))
+	require.NoError(t, err)
+
+	assert.Len(t, meta.Title, 255)
+	assert.Empty(t, meta.LanguageISO)
+	assert.NoError(t, validateMeta(meta))
+}
+
+func TestReadCoMet(t *testing.T) {
+	meta, err := NewCbzTool("blacksad-5.cbz").readCoMet([]byte(coMetXml))
+	require.NoError(t, err)
+
+	assert.Equal(t, &model.ArchiveMeta{
+		SeriesName:  "Blacksad",
+		Number:      "5",
+		Publisher:   "Dark Horse",
+		Title:       "Blacksad: Amarillo",
+		Year:        2014,
+		Month:       6,
+		Writer:      []string{"Juan Díaz Canales"},
+		Penciller:   []string{"Juanjo Guarnido"},
+		Genre:       []string{"Noir"},
+		LanguageISO: "en",
+		GTIN:        "9781616555254",
+	}, meta)
+}
+
+func TestReadCoMetSkipsOtherXml(t *testing.T) {
+	for _, content := range []string{`<rss><channel/></rss>`, `not xml at all`} {
+		meta, err := NewCbzTool("saga-54.cbz").readCoMet([]byte(content))
+		assert.NoError(t, err, content)
+		assert.Nil(t, meta, content)
+	}
+}
+
+func TestMetadataReaderMatching(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []string
+	}{
+		{"ComicInfo.xml", []string{"ComicInfo"}},
+		{"Saga 054/comicinfo.xml", []string{"ComicInfo"}},
+		{"ComicInfo (1).xml", []string{"ComicInfo"}},
+		{"MetronInfo.xml", []string{"MetronInfo"}},
+		{"saga-54.xml", []string{"CoMet"}},
+		{"page-01.jpg", nil},
+		{"notes.txt", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var matched []string
+			for _, reader := range metadataReaders {
+				if reader.matches(test.name) {
+					matched = append(matched, reader.name)
+				}
+			}
+			assert.Equal(t, test.expected, matched)
+		})
+	}
+}
+
+func TestCbzToolMergesMetadataByPrecedence(t *testing.T) {
+	comicInfo := `<ComicInfo>
+  <Series>Saga (2012)</Series>
+  <Number>54</Number>
+  <Publisher>Image Comics</Publisher>
+  <Letterer>Fonografiks</Letterer>
+  <Pages><Page Image="1" Type="Deleted" /></Pages>
+</ComicInfo>`
+	file := writeZip(t, [][2]string{
+		{"ComicInfo.xml", comicInfo},
+		{"MetronInfo.xml", metronInfoXml},
+		{"rss.xml", `<rss/>`},
+		{"01.jpg", jpegSignature},
+		{"02.jpg", jpegSignature},
+	})
+	info, err := file.Stat()
+	require.NoError(t, err)
+
+	meta, err := NewCbzTool("saga-54.cbz").GetMeta(file, info.Size())
+	require.NoError(t, err)
+
+	// MetronInfo wins, ComicInfo completes it and still provides the page list
+	assert.Equal(t, "Saga", meta.SeriesName)
+	assert.Equal(t, "Image", meta.Publisher)
+	assert.Equal(t, []string{"Fonografiks"}, meta.Letterer)
+	assert.Equal(t, 1, meta.PagesCount)
+}
+
+func TestCbzToolFailsOnlyWithoutUsableMetadata(t *testing.T) {
+	file := writeZip(t, [][2]string{
+		{"ComicInfo.xml", "<ComicInfo><Series>broken"},
+		{"saga 054 01.jpg", jpegSignature},
+	})
+	info, err := file.Stat()
+	require.NoError(t, err)
+
+	_, err = NewCbzTool("saga 054.cbz").GetMeta(file, info.Size())
+	assert.Error(t, err)
+
+	file = writeZip(t, [][2]string{
+		{"ComicInfo.xml", "<ComicInfo><Series>broken"},
+		{"MetronInfo.xml", metronInfoXml},
+		{"saga 054 01.jpg", jpegSignature},
+	})
+	info, err = file.Stat()
+	require.NoError(t, err)
+
+	meta, err := NewCbzTool("saga 054.cbz").GetMeta(file, info.Size())
+	require.NoError(t, err)
+	assert.Equal(t, "Saga", meta.SeriesName)
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"paper/purgatory/model"
+	"strings"
+	"time"
+)
+
+// metronInfo is the MetronInfo.xml v1 schema written by Metron-Tagger and friends
+type metronInfo struct {
+	Publisher struct {
+		Name    string `xml:"Name"`
+		Imprint string `xml:"Imprint"`
+		// Drafts of the schema had the name as text content
+		Text string `xml:",chardata"`
+	} `xml:"Publisher"`
+	Series struct {
+		Lang             string   `xml:"lang,attr"`
+		Name             string   `xml:"Name"`
+		Volume           string   `xml:"Volume"`
+		Format           string   `xml:"Format"`
+		IssueCount       string   `xml:"IssueCount"`
+		AlternativeNames []string `xml:"AlternativeNames>AlternativeName"`
+	} `xml:"Series"`
+	CollectionTitle string   `xml:"CollectionTitle"`
+	Number          string   `xml:"Number"`
+	Stories         []string `xml:"Stories>Story"`
+	Summary         string   `xml:"Summary"`
+	Notes           string   `xml:"Notes"`
+	CoverDate       string   `xml:"CoverDate"`
+	GTIN            struct {
+		ISBN string `xml:"ISBN"`
+		UPC  string `xml:"UPC"`
+	} `xml:"GTIN"`
+	AgeRating string   `xml:"AgeRating"`
+	Genres    []string `xml:"Genres>Genre"`
+	Tags      []string `xml:"Tags>Tag"`
+	Arcs      []struct {
+		Name   string `xml:"Name"`
+		Number string `xml:"Number"`
+	} `xml:"Arcs>Arc"`
+	Characters    []string `xml:"Characters>Character"`
+	Teams         []string `xml:"Teams>Team"`
+	Locations     []string `xml:"Locations>Location"`
+	URLs          []string `xml:"URLs>URL"`
+	BlackAndWhite string   `xml:"BlackAndWhite"`
+	Credits       []struct {
+		Creator string   `xml:"Creator"`
+		Roles   []string `xml:"Roles>Role"`
+	} `xml:"Credits>Credit"`
+}
+
+// metronAgeRatings maps MetronInfo ratings to the closest ComicInfo ones
+var metronAgeRatings = map[string]string{
+	"unknown":   "Unknown",
+	"everyone":  "Everyone",
+	"teen":      "Teen",
+	"teen plus": "Teen",
+	"mature":    "Mature 17+",
+	"explicit":  "Adults Only 18+",
+	"adult":     "Adults Only 18+",
+}
+
+func (b *baseArchiveTool) readMetronInfo(content []byte) (*model.ArchiveMeta, error) {
+	var info metronInfo
+	if _, err := decodeMetadataXml(content, "MetronInfo", &info); err != nil {
+		return nil, err
+	}
+
+	meta := &model.ArchiveMeta{
+		SeriesName:  strings.TrimSpace(info.Series.Name),
+		Summary:     strings.TrimSpace(info.Summary),
+		Publisher:   firstNonEmpty(info.Publisher.Name, info.Publisher.Text),
+		Title:       truncateText(firstNonEmpty(info.CollectionTitle, strings.Join(info.Stories, "; "))),
+		Volume:      parsePositive(info.Series.Volume),
+		Count:       parsePositive(info.Series.IssueCount),
+		Notes:       strings.TrimSpace(info.Notes),
+		Imprint:     strings.TrimSpace(info.Publisher.Imprint),
+		Format:      strings.TrimSpace(info.Series.Format),
+		LanguageISO: languageCode(info.Series.Lang),
+		AgeRating:   metronAgeRatings[strings.ToLower(strings.TrimSpace(info.AgeRating))],
+		GTIN:        validGTIN(info.GTIN.ISBN, info.GTIN.UPC),
+		Genre:       trimValues(info.Genres),
+		Tags:        trimValues(info.Tags),
+		Web:         trimValues(info.URLs),
+		Characters:  trimValues(info.Characters),
+		Teams:       trimValues(info.Teams),
+		Locations:   trimValues(info.Locations),
+	}
+
+	if number := strings.TrimSpace(info.Number); number != "" {
+		meta.Number = b.normalizeNumber(number)
+	}
+
+	if len(info.Series.AlternativeNames) > 0 {
+		meta.AlternateSeries = strings.TrimSpace(info.Series.AlternativeNames[0])
+	}
+
+	if date, err := time.Parse(time.DateOnly, strings.TrimSpace(info.CoverDate)); err == nil {
+		meta.Year, meta.Month, meta.Day = date.Year(), int(date.Month()), date.Day()
+	}
+
+	if blackAndWhite := strings.TrimSpace(info.BlackAndWhite); blackAndWhite != "" {
+		meta.BlackAndWhite = model.YesNoNo
+		if strings.EqualFold(blackAndWhite, "true") {
+			meta.BlackAndWhite = model.YesNoYes
+		}
+	}
+
+	var arcs, arcNumbers []string
+	for _, arc := range info.Arcs {
+		if name := strings.TrimSpace(arc.Name); name != "" {
+			arcs = append(arcs, name)
+			arcNumbers = append(arcNumbers, strings.TrimSpace(arc.Number))
+		}
+	}
+	meta.StoryArc = strings.Join(arcs, ", ")
+	if strings.Join(arcNumbers, "") != "" {
+		meta.StoryArcNumber = strings.Join(arcNumbers, ", ")
+	}
+
+	for _, credit := range info.Credits {
+		for _, role := range credit.Roles {
+			addCredit(meta, role, credit.Creator)
+		}
+	}
+
+	return meta, nil
+}
+
+func trimValues(values []string) []string {
+	var trimmed []string
+	for _, value := range values {
+		if value = truncateText(value); value != "" {
+			trimmed = append(trimmed, value)
+		}
+	}
+	return trimmed
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/cases"
+)
+
+// coverRegex matches page names like "cover.jpg", "00_Cover" or "front", but not "back cover"
+var coverRegex = regexp.MustCompile(`(?i)(^|[^a-z])(cover|front|fc)([^a-z]|$)`)
+
+// pageName is an entry name with its case folded once, as folding in every comparison of a
+// sort allocates O(n log n) times per archive
+type pageName struct {
+	original string
+	segments []string
+}
+
+func newPageName(name string) pageName {
+	return pageName{original: name, segments: splitEntryPath(cases.Fold().String(name))}
+}
+
+// sortPages orders items for reading by the entry name each of them has
+func sortPages[T any](items []T, name func(item T) string) {
+	type keyedItem struct {
+		key  pageName
+		item T
+	}
+
+	keyed := make([]keyedItem, len(items))
+	for index, item := range items {
+		keyed[index] = keyedItem{key: newPageName(name(item)), item: item}
+	}
+
+	sort.SliceStable(keyed, func(i, j int) bool {
+		return pageLess(keyed[i].key, keyed[j].key)
+	})
+
+	for index := range keyed {
+		items[index] = keyed[index].item
+	}
+}
+
+// pageLess orders archive entries for reading: folder by folder, loose files before subfolders,
+// cover pages first within their folder and names compared naturally.
+func pageLess(a, b pageName) bool {
+	aSegments := a.segments
+	bSegments := b.segments
+
+	for index := 0; index < len(aSegments) && index < len(bSegments); index++ {
+		aIsFile := index == len(aSegments)-1
+		bIsFile := index == len(bSegments)-1
+
+		if aIsFile != bIsFile {
+			return aIsFile
+		}
+
+		if aIsFile {
+			aCover := isCoverPage(aSegments[index])
+			bCover := isCoverPage(bSegments[index])
+			if aCover != bCover {
+				return aCover
+			}
+		}
+
+		// File names are compared without extensions, so "img.jpg" goes before "img1.jpg"
+		aName, bName := aSegments[index], bSegments[index]
+		if aIsFile {
+			aName = strings.TrimSuffix(aName, fileExtension(aName))
+			bName = strings.TrimSuffix(bName, fileExtension(bName))
+		}
+
+		if aName != bName {
+			return naturalLess(aName, bName)
+		}
+		if aSegments[index] != bSegments[index] {
+			return naturalLess(aSegments[index], bSegments[index])
+		}
+	}
+
+	if len(aSegments) != len(bSegments) {
+		return len(aSegments) < len(bSegments)
+	}
+
+	// Names equal but for case still need a stable order
+	return a.original < b.original
+}
+
+func splitEntryPath(name string) []string {
+	name = strings.Trim(strings.ReplaceAll(name, "\\", "/"), "/")
+	return strings.Split(name, "/")
+}
+
+func isCoverPage(name string) bool {
+	stem := strings.TrimSuffix(name, fileExtension(name))
+	return coverRegex.MatchString(stem) && !strings.Contains(strings.ToLower(stem), "back")
+}
+
+func fileExtension(name string) string {
+	index := strings.LastIndex(name, ".")
+	if index <= 0 {
+		return ""
+	}
+	return name[index:]
+}
+
+// naturalLess compares case folded names treating digit runs as numbers, so "2.jpg" goes before "10.jpg"
+func naturalLess(a, b string) bool {
+	aLower := a
+	bLower := b
+
+	for aLower != "" && bLower != "" {
+		aChunk, aNumeric := nextChunk(aLower)
+		bChunk, bNumeric := nextChunk(bLower)
+		aLower = aLower[len(aChunk):]
+		bLower = bLower[len(bChunk):]
+
+		if aNumeric && bNumeric {
+			aDigits := strings.TrimLeft(aChunk, "0")
+			bDigits := strings.TrimLeft(bChunk, "0")
+			if len(aDigits) != len(bDigits) {
+				return len(aDigits) < len(bDigits)
+			}
+			if aDigits != bDigits {
+				return aDigits < bDigits
+			}
+			continue
+		}
+
+		if aChunk != bChunk {
+			return aChunk < bChunk
+		}
+	}
+
+	if len(aLower) != len(bLower) {
+		return len(aLower) < len(bLower)
+	}
+
+	// Names equal but for zero padding still need a stable order
+	return a < b
+}
+
+// nextChunk returns the leading run of either digits or non-digits
+func nextChunk(value string) (string, bool) {
+	numeric := isDigit(value[0])
+	for index, char := range value {
+		if (char >= '0' && char <= '9') != numeric {
+			return value[:index], numeric
+		}
+	}
+	return value, numeric
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/cases"
+)
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"2.jpg", "10.jpg", true},
+		{"10.jpg", "2.jpg", false},
+		{"p001.jpg", "p002.jpg", true},
+		{"p2.jpg", "p010.jpg", true},
+		{"page 9.png", "page 10.png", true},
+		{"Page 1.jpg", "page 2.jpg", true},
+		{"a.jpg", "B.jpg", true},
+		{"img", "img1", true},
+		{"01.jpg", "1.jpg", true},
+		{"1.jpg", "01.jpg", false},
+		{"x.jpg", "x.jpg", false},
+		{"saga_054_099.jpg", "saga_054_100.jpg", true},
+		{"99999999999999999999.jpg", "100000000000000000000.jpg", true},
+		{"a 1.jpg", "a  1.jpg", true},
+		{"a  1.jpg", "a 1.jpg", false},
+		{"ÉTÉ 2.jpg", "été 10.jpg", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.a+" < "+test.b, func(t *testing.T) {
+			assert.Equal(t, test.expected, naturalLess(cases.Fold().String(test.a), cases.Fold().String(test.b)))
+		})
+	}
+}
+
+func TestIsCoverPage(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"cover.jpg", true},
+		{"Cover.png", true},
+		{"00_cover.jpg", true},
+		{"saga 054 - front.jpg", true},
+		{"saga_054_fc.jpg", true},
+		{"back cover.jpg", false},
+		{"backcover.jpg", false},
+		{"discovery.jpg", false},
+		{"coverage.jpg", false},
+		{"p001.jpg", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, isCoverPage(test.name))
+		})
+	}
+}
+
+func TestPageOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []string
+	}{
+		{
+			name:     "numeric runs",
+			expected: []string{"1.jpg", "2.jpg", "9.jpg", "10.jpg", "11.jpg", "100.jpg"},
+		},
+		{
+			name:     "extensions ignored",
+			expected: []string{"img.png", "img1.jpg", "img2.jpg", "img10.gif"},
+		},
+		{
+			name:     "cover before prefixed pages",
+			expected: []string{"cover.jpg", "p001.jpg", "p002.jpg", "p010.jpg"},
+		},
+		{
+			name:     "cover with the issue prefix",
+			expected: []string{"Saga 054 - Cover.jpg", "Saga 054 - 01.jpg", "Saga 054 - 02.jpg", "Saga 054 - back cover.jpg"},
+		},
+		{
+			name: "chapter folders",
+			expected: []string{
+				"cover.jpg",
+				"credits.jpg",
+				"Chapter 2/01.jpg",
+				"Chapter 2/02.jpg",
+				"Chapter 10/01.jpg",
+				"Chapter 10/extra/01.jpg",
+			},
+		},
+		{
+			name: "cover inside a folder",
+			expected: []string{
+				"Vol 1/Chapter 1/cover.png",
+				"Vol 1/Chapter 1/1.png",
+				"Vol 1/Chapter 1/2.png",
+				"Vol 1/Chapter 2/1.png",
+				"Vol 2/Chapter 3/1.png",
+			},
+		},
+		{
+			name:     "windows separators",
+			expected: []string{`Chapter 1\1.jpg`, "Chapter 1/2.jpg", `Chapter 2\1.jpg`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			names := append([]string(nil), test.expected...)
+			random := rand.New(rand.NewSource(1))
+			random.Shuffle(len(names), func(i, j int) { names[i], names[j] = names[j], names[i] })
+
+			sortPages(names, func(name string) string { return name })
+
+			assert.Equal(t, test.expected, names)
+		})
+	}
+}
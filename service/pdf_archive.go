@@ -0,0 +1,302 @@
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"paper/purgatory/model"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	rasterizeResolution = 150
+	// Tolerated difference between the aspect ratios of a page and its only image
+	fullPageImageTolerance = 0.03
+)
+
+func init() {
+	// pdfcpu would otherwise create and read a config.yml in the user config directory
+	pdfmodel.ConfigPath = "disable"
+}
+
+type PdfTool struct {
+	baseArchiveTool
+}
+
+func NewPdfTool(fileName string) *PdfTool {
+	return &PdfTool{
+		baseArchiveTool: baseArchiveTool{fileName: fileName},
+	}
+}
+
+// xmpDescription picks the Dublin Core and PRISM properties publishers put into XMP.
+// Namespaces are ignored on purpose, as PRISM is written with several versioned URIs.
+type xmpDescription struct {
+	Title               []string `xml:"title>Alt>li"`
+	Description         []string `xml:"description>Alt>li"`
+	Publisher           []string `xml:"publisher>Bag>li"`
+	PublicationName     string   `xml:"publicationName"`
+	PublicationNameAttr string   `xml:"publicationName,attr"`
+	Number              string   `xml:"number"`
+	NumberAttr          string   `xml:"number,attr"`
+	IssueIdentifier     string   `xml:"issueIdentifier"`
+	IssueIdentifierAttr string   `xml:"issueIdentifier,attr"`
+}
+
+type pdfPageImage struct {
+	content  []byte
+	fileType string
+}
+
+type xmpPacket struct {
+	Descriptions []xmpDescription `xml:"RDF>Description"`
+}
+
+func (p *PdfTool) GetMeta(file *os.File, _ int64) (*model.ArchiveMeta, error) {
+	ctx, err := p.readContext(file, false)
+	if err != nil {
+		return nil, err
+	}
+
+	xmp, err := p.readXmp(ctx)
+	if err != nil {
+		// Broken XMP shouldn't hide the document info dictionary
+		fmt.Println("failed to read XMP metadata of", p.fileName, err)
+	}
+
+	meta := &model.ArchiveMeta{
+		SeriesName: firstNonEmpty(xmp.PublicationName, xmp.PublicationNameAttr, ctx.Properties["Series"]),
+		Summary:    firstNonEmpty(first(xmp.Description), ctx.Subject),
+		Publisher:  firstNonEmpty(first(xmp.Publisher), ctx.Properties["Publisher"]),
+		PagesCount: ctx.PageCount,
+	}
+
+	title := firstNonEmpty(first(xmp.Title), ctx.Title)
+	if meta.SeriesName == "" {
+		meta.SeriesName = title
+	}
+
+	number := firstNonEmpty(xmp.Number, xmp.NumberAttr, xmp.IssueIdentifier, xmp.IssueIdentifierAttr, ctx.Properties["Number"])
+	if number != "" {
+		meta.Number = p.normalizeNumber(number)
+	}
+
+	if meta.SeriesName == "" {
+		meta.SeriesName = p.resolveSeriesName(p.fileName)
+	}
+	if meta.Number == "" {
+		meta.Number = p.resolveNumber(meta.SeriesName)
+	}
+
+	return meta, nil
+}
+
+func (p *PdfTool) Extract(file *os.File, destination string) ([]model.Page, error) {
+	ctx, err := p.readContext(file, true)
+	if err != nil {
+		return nil, err
+	}
+
+	dims, err := ctx.PageDims()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF page sizes: %v", err)
+	}
+
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create destination directory: %v", err)
+	}
+
+	digits := len(strconv.Itoa(ctx.PageCount))
+	var extractedFiles []extractedFile
+
+	for pageNr := 1; pageNr <= ctx.PageCount; pageNr++ {
+		name := filepath.Join(destination, fmt.Sprintf("page-%0*d", digits, pageNr))
+
+		pageImage, err := p.fullPageImage(ctx, pageNr, dims[pageNr-1].AspectRatio())
+		if err != nil {
+			return nil, err
+		}
+
+		var outputPath string
+		if pageImage != nil {
+			outputPath, err = p.writeImage(pageImage, name)
+		} else {
+			outputPath, err = p.rasterize(file.Name(), pageNr, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		extractedFiles = append(extractedFiles, extractedFile{path: outputPath, name: filepath.Base(outputPath)})
+	}
+
+	return p.renameFiles(destination, extractedFiles)
+}
+
+// readContext parses the document, optionally indexing its images for extraction
+func (p *PdfTool) readContext(file *os.File, withImages bool) (*pdfmodel.Context, error) {
+	if _, err := file.Seek(0, 0); err != nil {
+		return nil, fmt.Errorf("failed to seek file: %v", err)
+	}
+
+	conf := pdfmodel.NewDefaultConfiguration()
+	conf.ValidationMode = pdfmodel.ValidationRelaxed
+
+	var ctx *pdfmodel.Context
+	var err error
+	if withImages {
+		conf.Cmd = pdfmodel.EXTRACTIMAGES
+		ctx, err = api.ReadValidateAndOptimize(file, conf)
+	} else {
+		ctx, err = api.ReadAndValidate(file, conf)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %v", err)
+	}
+
+	return ctx, nil
+}
+
+func (p *PdfTool) readXmp(ctx *pdfmodel.Context) (xmpDescription, error) {
+	merged := xmpDescription{}
+
+	catalog, err := ctx.Catalog()
+	if err != nil {
+		return merged, err
+	}
+
+	reference := catalog.IndirectRefEntry("Metadata")
+	if reference == nil {
+		return merged, nil
+	}
+
+	stream, _, err := ctx.DereferenceStreamDict(*reference)
+	if err != nil || stream == nil {
+		return merged, err
+	}
+
+	if err := stream.Decode(); err != nil {
+		return merged, err
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(stream.Content))
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	var packet xmpPacket
+	if err := decoder.Decode(&packet); err != nil {
+		return merged, err
+	}
+
+	// Properties may be spread over several rdf:Description elements
+	for _, description := range packet.Descriptions {
+		merged.Title = append(merged.Title, description.Title...)
+		merged.Description = append(merged.Description, description.Description...)
+		merged.Publisher = append(merged.Publisher, description.Publisher...)
+		merged.PublicationName = firstNonEmpty(merged.PublicationName, description.PublicationName)
+		merged.PublicationNameAttr = firstNonEmpty(merged.PublicationNameAttr, description.PublicationNameAttr)
+		merged.Number = firstNonEmpty(merged.Number, description.Number)
+		merged.NumberAttr = firstNonEmpty(merged.NumberAttr, description.NumberAttr)
+		merged.IssueIdentifier = firstNonEmpty(merged.IssueIdentifier, description.IssueIdentifier)
+		merged.IssueIdentifierAttr = firstNonEmpty(merged.IssueIdentifierAttr, description.IssueIdentifierAttr)
+	}
+
+	return merged, nil
+}
+
+// fullPageImage returns the embedded image of a page that consists of that single image only
+func (p *PdfTool) fullPageImage(ctx *pdfmodel.Context, pageNr int, pageAspectRatio float64) (*pdfPageImage, error) {
+	images, err := pdfcpu.ExtractPageImages(ctx, pageNr, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract images of page %d: %v", pageNr, err)
+	}
+
+	var candidates []pdfmodel.Image
+	for _, candidate := range images {
+		if !candidate.Thumb && !candidate.IsImgMask {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	if len(candidates) != 1 {
+		return nil, nil
+	}
+
+	content, err := io.ReadAll(candidates[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image of page %d: %v", pageNr, err)
+	}
+
+	// Formats Go can't decode (e.g. JPEG 2000) are trusted to fill the page
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err == nil && config.Height > 0 && pageAspectRatio > 0 {
+		imageAspectRatio := float64(config.Width) / float64(config.Height)
+		if math.Abs(imageAspectRatio-pageAspectRatio)/pageAspectRatio > fullPageImageTolerance {
+			return nil, nil
+		}
+	}
+
+	return &pdfPageImage{content: content, fileType: candidates[0].FileType}, nil
+}
+
+func (p *PdfTool) writeImage(image *pdfPageImage, name string) (string, error) {
+	outputPath := name + "." + image.fileType
+	if err := os.WriteFile(outputPath, image.content, 0644); err != nil {
+		return "", fmt.Errorf("failed to write file %s: %v", outputPath, err)
+	}
+
+	return outputPath, nil
+}
+
+// rasterize renders pages that aren't a plain scan with poppler's pdftoppm
+func (p *PdfTool) rasterize(input string, pageNr int, name string) (string, error) {
+	page := strconv.Itoa(pageNr)
+	command := exec.Command(
+		"pdftoppm",
+		"-f", page,
+		"-l", page,
+		"-r", strconv.Itoa(rasterizeResolution),
+		"-jpeg",
+		"-singlefile",
+		input,
+		name,
+	)
+
+	output, err := command.CombinedOutput()
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", fmt.Errorf("page %d has to be rasterized, but pdftoppm is not installed", pageNr)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to rasterize page %d: %v: %s", pageNr, err, strings.TrimSpace(string(output)))
+	}
+
+	return name + ".jpg", nil
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if trimmed := strings.TrimSpace(value); trimmed != "" {
+			return trimmed
+		}
+	}
+	return ""
+}
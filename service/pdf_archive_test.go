@@ -0,0 +1,92 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPdfToolGetMetaFromInfoDictionary(t *testing.T) {
+	file, size := openFixture(t, "properties.pdf")
+
+	meta, err := NewPdfTool("saga-54.pdf").GetMeta(file, size)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Saga", meta.SeriesName)
+	assert.Equal(t, "54", meta.Number)
+	assert.Equal(t, "Image Comics", meta.Publisher)
+	assert.Equal(t, 2, meta.PagesCount)
+}
+
+func TestPdfToolGetMetaPrefersXmp(t *testing.T) {
+	file, size := openFixture(t, "xmp.pdf")
+
+	meta, err := NewPdfTool("scan.pdf").GetMeta(file, size)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Saga", meta.SeriesName)
+	assert.Equal(t, "54", meta.Number)
+	assert.Equal(t, "Image Comics", meta.Publisher)
+	assert.Equal(t, "Hazel grows up.", meta.Summary)
+	assert.Equal(t, 1, meta.PagesCount)
+}
+
+func TestPdfToolExtractsFullPageImages(t *testing.T) {
+	file, _ := openFixture(t, "properties.pdf")
+	destination := t.TempDir()
+
+	pages, err := NewPdfTool("saga-54.pdf").Extract(file, destination)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"0.png", "1.png"}, extractedNames(t, destination))
+	assert.Len(t, pages, 2)
+}
+
+func TestPdfToolRasterizesVectorPages(t *testing.T) {
+	bin := t.TempDir()
+	arguments := filepath.Join(bin, "arguments")
+	// Stands in for poppler: records its arguments and writes a JPEG header to the output name
+	script := "#!/bin/sh\necho \"$@\" > " + arguments + "\nfor last; do :; done\nprintf '\\377\\330\\377\\340' > \"$last.jpg\"\n"
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "pdftoppm"), []byte(script), 0755))
+	t.Setenv("PATH", bin)
+
+	file, _ := openFixture(t, "xmp.pdf")
+	destination := t.TempDir()
+
+	pages, err := NewPdfTool("saga-54.pdf").Extract(file, destination)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"0.jpg"}, extractedNames(t, destination))
+	require.Len(t, pages, 1)
+	assert.Equal(t, "jpeg", pages[0].Format)
+
+	recorded, err := os.ReadFile(arguments)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(recorded), "-f 1 -l 1 -r 150 -jpeg -singlefile "), string(recorded))
+}
+
+func TestPdfToolRasterizeWithoutPdftoppm(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	file, _ := openFixture(t, "xmp.pdf")
+
+	_, err := NewPdfTool("saga-54.pdf").Extract(file, t.TempDir())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pdftoppm is not installed")
+}
+
+func TestPdfToolExtractsJpeg2000Pages(t *testing.T) {
+	file, _ := openFixture(t, "jpx.pdf")
+	destination := t.TempDir()
+
+	pages, err := NewPdfTool("saga-54.pdf").Extract(file, destination)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"0.jp2", "1.jp2"}, extractedNames(t, destination))
+	require.Len(t, pages, 2)
+	assert.Equal(t, "jp2", pages[0].Format)
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"image"
+	"maps"
+	"math/bits"
+	"os"
+	"paper/purgatory/dto"
+	"paper/purgatory/model"
+	"paper/purgatory/utils"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// maxPerceptualDistance is how many of the 64 hash bits may differ between two scans
+	// of the same page, as recompression and resizing flip a few of them
+	maxPerceptualDistance = 10
+	// similarPagesRatio is the share of the smaller item's pages that must look the same elsewhere
+	similarPagesRatio = 0.8
+	// perceptualBands is how many 16 bit bands hashes are indexed by. Two hashes within
+	// maxPerceptualDistance differ by at most perceptualBandDistance bits in one band at least.
+	perceptualBands        = 4
+	perceptualBandDistance = maxPerceptualDistance / perceptualBands
+)
+
+// perceptualBandMasks are the 16 bit values with at most perceptualBandDistance bits set
+var perceptualBandMasks = func() []uint16 {
+	var masks []uint16
+	for mask := range 1 << 16 {
+		if bits.OnesCount16(uint16(mask)) <= perceptualBandDistance {
+			masks = append(masks, uint16(mask))
+		}
+	}
+	return masks
+}()
+
+// perceptualHash computes the dHash of an image: it is shrunk to 9x8 grey pixels and each bit
+// tells whether a pixel is brighter than its right neighbour. Unlike SHA-256 it survives
+// recompression, resizing and small color changes.
+func perceptualHash(picture image.Image) uint64 {
+	bounds := picture.Bounds()
+	grey := image.NewGray(image.Rect(0, 0, 9, 8))
+	draw.CatmullRom.Scale(grey, grey.Bounds(), picture, bounds, draw.Src, nil)
+
+	var hash uint64
+	for y := range 8 {
+		for x := range 8 {
+			hash <<= 1
+			if grey.GrayAt(x, y).Y > grey.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+func formatPerceptualHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// perceptualDistance counts the differing bits of two hashes. Missing or featureless hashes,
+// like those of blank pages, never match anything.
+func perceptualDistance(a string, b string) (int, bool) {
+	first, err := strconv.ParseUint(a, 16, 64)
+	if err != nil || isFeatureless(first) {
+		return 0, false
+	}
+	second, err := strconv.ParseUint(b, 16, 64)
+	if err != nil || isFeatureless(second) {
+		return 0, false
+	}
+
+	return bits.OnesCount64(first ^ second), true
+}
+
+func isFeatureless(hash uint64) bool {
+	return hash == 0 || hash == ^uint64(0)
+}
+
+func looksSame(a string, b string) bool {
+	distance, ok := perceptualDistance(a, b)
+	return ok && distance <= maxPerceptualDistance
+}
+
+// hashPagesPerceptually records the perceptual hash of every page. Pages Go can't decode,
+// like AVIF or JPEG XL, are left without one.
+func hashPagesPerceptually(directory string, pages []model.Page) {
+	for index := range pages {
+		hash, err := perceptualHashFile(filepath.Join(directory, pages[index].File))
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		pages[index].PerceptualHash = hash
+	}
+}
+
+func perceptualHashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open page %s: %v", path, err)
+	}
+	defer utils.HandleClose(file.Close)
+
+	picture, _, err := image.Decode(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode page %s: %v", path, err)
+	}
+
+	return formatPerceptualHash(perceptualHash(picture)), nil
+}
+
+// similarPages counts the look-alike pages both items have in the same reading order. It is the
+// longest common subsequence of the two, so any number of inserted or dropped pages like
+// scanner credits leave the rest of the sequence matched.
+func similarPages(pages []model.Page, other []model.Page) int {
+	if len(pages) > len(other) {
+		pages, other = other, pages
+	}
+
+	// Only the previous row of the table is needed, sized by the shorter item
+	previous := make([]int, len(pages)+1)
+	current := make([]int, len(pages)+1)
+	for _, otherPage := range other {
+		for index, page := range pages {
+			if looksSame(page.PerceptualHash, otherPage.PerceptualHash) {
+				current[index+1] = previous[index] + 1
+			} else {
+				current[index+1] = max(previous[index+1], current[index])
+			}
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(pages)]
+}
+
+// perceptualEntry is a hash in a perceptualIndex along with the item it belongs to
+type perceptualEntry struct {
+	owner int
+	hash  uint64
+}
+
+// perceptualIndex finds the hashes that look the same as a given one without comparing it to
+// all of them, by looking up only the band values a few bits away from the hash's own
+type perceptualIndex map[uint32][]perceptualEntry
+
+func perceptualBand(hash uint64, band int) uint16 {
+	return uint16(hash >> (16 * band))
+}
+
+func (index perceptualIndex) add(owner int, hash uint64) {
+	for band := range perceptualBands {
+		key := uint32(band)<<16 | uint32(perceptualBand(hash, band))
+		index[key] = append(index[key], perceptualEntry{owner: owner, hash: hash})
+	}
+}
+
+// near calls found for the owner of every hash within maxPerceptualDistance, possibly more than once
+func (index perceptualIndex) near(hash uint64, found func(owner int)) {
+	for band := range perceptualBands {
+		value := perceptualBand(hash, band)
+		for _, mask := range perceptualBandMasks {
+			for _, entry := range index[uint32(band)<<16|uint32(value^mask)] {
+				if bits.OnesCount64(hash^entry.hash) <= maxPerceptualDistance {
+					found(entry.owner)
+				}
+			}
+		}
+	}
+}
+
+// itemPerceptualHashes returns the distinct hashes of the item's cover and pages that can match anything
+func itemPerceptualHashes(item *model.PurgatoryItem) []uint64 {
+	var hashes []uint64
+	for _, value := range append([]string{item.CoverHash}, pagePerceptualHashes(item.Pages)...) {
+		hash, err := strconv.ParseUint(value, 16, 64)
+		if err != nil || isFeatureless(hash) || slices.Contains(hashes, hash) {
+			continue
+		}
+		hashes = append(hashes, hash)
+	}
+
+	return hashes
+}
+
+func pagePerceptualHashes(pages []model.Page) []string {
+	hashes := make([]string, 0, len(pages))
+	for _, page := range pages {
+		hashes = append(hashes, page.PerceptualHash)
+	}
+
+	return hashes
+}
+
+// visualCandidates pairs up the items sharing at least one look-alike cover or page, in item
+// order, so only those pairs need comparing page by page
+func visualCandidates(items []model.PurgatoryItem) [][2]int {
+	index := perceptualIndex{}
+	hashes := make([][]uint64, len(items))
+	for owner := range items {
+		hashes[owner] = itemPerceptualHashes(&items[owner])
+		for _, hash := range hashes[owner] {
+			index.add(owner, hash)
+		}
+	}
+
+	candidates := map[[2]int]bool{}
+	for owner := range items {
+		for _, hash := range hashes[owner] {
+			index.near(hash, func(other int) {
+				if other > owner {
+					candidates[[2]int{owner, other}] = true
+				}
+			})
+		}
+	}
+
+	pairs := slices.Collect(maps.Keys(candidates))
+	slices.SortFunc(pairs, func(a, b [2]int) int {
+		return cmp.Or(cmp.Compare(a[0], b[0]), cmp.Compare(a[1], b[1]))
+	})
+
+	return pairs
+}
+
+// compareVisually tells whether two items look like scans of the same issue
+func compareVisually(item *model.PurgatoryItem, other *model.PurgatoryItem) (dto.VisualMatch, bool) {
+	match := dto.VisualMatch{ItemID: item.ID, OtherID: other.ID, CoverDistance: -1}
+
+	coverDistance, coversHashed := perceptualDistance(item.CoverHash, other.CoverHash)
+	if coversHashed {
+		match.CoverDistance = coverDistance
+	}
+
+	shorter := min(len(item.Pages), len(other.Pages))
+	if shorter > 0 {
+		match.SimilarPages = similarPages(item.Pages, other.Pages)
+		match.PageSimilarity = float64(match.SimilarPages) / float64(shorter)
+	}
+
+	similarCovers := coversHashed && coverDistance <= maxPerceptualDistance
+	return match, similarCovers || match.PageSimilarity >= similarPagesRatio
+}
+
+// groupVisualDuplicates compares the candidate pairs of items and joins look-alikes into groups,
+// so three scans of one issue show up together
+func groupVisualDuplicates(items []model.PurgatoryItem) [][]dto.VisualMatch {
+	parents := make([]int, len(items))
+	for index := range parents {
+		parents[index] = index
+	}
+	var root func(index int) int
+	root = func(index int) int {
+		if parents[index] != index {
+			parents[index] = root(parents[index])
+		}
+		return parents[index]
+	}
+
+	var matches []dto.VisualMatch
+	var owners []int
+	for _, pair := range visualCandidates(items) {
+		i, j := pair[0], pair[1]
+		match, similar := compareVisually(&items[i], &items[j])
+		if !similar {
+			continue
+		}
+
+		matches = append(matches, match)
+		owners = append(owners, i)
+		parents[root(j)] = root(i)
+	}
+
+	var groups [][]dto.VisualMatch
+	groupIndexes := map[int]int{}
+	for index, match := range matches {
+		group, ok := groupIndexes[root(owners[index])]
+		if !ok {
+			group = len(groups)
+			groupIndexes[root(owners[index])] = group
+			groups = append(groups, nil)
+		}
+		groups[group] = append(groups[group], match)
+	}
+
+	return groups
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"paper/purgatory/model"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/draw"
+)
+
+// drawPage paints a page of blocks whose brightness depends on the seed, standing in for artwork
+func drawPage(seed int, width int, height int) image.Image {
+	page := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			block := (x*12/width)*7 + (y*16/height)*13 + seed*31
+			shade := uint8((block * 53) % 256)
+			page.Set(x, y, color.RGBA{R: shade, G: shade / 2, B: 255 - shade, A: 255})
+		}
+	}
+	return page
+}
+
+// rescan simulates another scan group's release of the same page: resized and recompressed
+func rescan(t *testing.T, page image.Image, width int, height int) image.Image {
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(resized, resized.Bounds(), page, page.Bounds(), draw.Src, nil)
+
+	var buffer bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buffer, resized, &jpeg.Options{Quality: 40}))
+	decoded, err := jpeg.Decode(&buffer)
+	require.NoError(t, err)
+	return decoded
+}
+
+func hashOf(page image.Image) string {
+	return formatPerceptualHash(perceptualHash(page))
+}
+
+func TestPerceptualHashSurvivesRescans(t *testing.T) {
+	original := drawPage(1, 1200, 1800)
+
+	distance, ok := perceptualDistance(hashOf(original), hashOf(rescan(t, original, 800, 1200)))
+	require.True(t, ok)
+	assert.LessOrEqual(t, distance, maxPerceptualDistance)
+
+	distance, ok = perceptualDistance(hashOf(original), hashOf(drawPage(2, 1200, 1800)))
+	require.True(t, ok)
+	assert.Greater(t, distance, maxPerceptualDistance)
+}
+
+func TestPerceptualDistanceIgnoresFeaturelessPages(t *testing.T) {
+	blank := image.NewGray(image.Rect(0, 0, 100, 150))
+	draw.Draw(blank, blank.Bounds(), image.White, image.Point{}, draw.Src)
+
+	_, ok := perceptualDistance(hashOf(blank), hashOf(blank))
+	assert.False(t, ok)
+
+	_, ok = perceptualDistance("", hashOf(drawPage(1, 100, 150)))
+	assert.False(t, ok)
+}
+
+func TestHashPagesPerceptually(t *testing.T) {
+	directory := t.TempDir()
+
+	var buffer bytes.Buffer
+	require.NoError(t, png.Encode(&buffer, drawPage(1, 90, 120)))
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "0.png"), buffer.Bytes(), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "1.avif"), []byte("not decodable"), 0644))
+
+	pages := []model.Page{{Index: 0, File: "0.png"}, {Index: 1, File: "1.avif"}}
+	hashPagesPerceptually(directory, pages)
+
+	assert.Equal(t, hashOf(drawPage(1, 90, 120)), pages[0].PerceptualHash)
+	assert.Empty(t, pages[1].PerceptualHash)
+}
+
+func TestSimilarPages(t *testing.T) {
+	pages := func(seeds ...int) []model.Page {
+		result := make([]model.Page, len(seeds))
+		for index, seed := range seeds {
+			result[index] = model.Page{Index: index, PerceptualHash: hashOf(drawPage(seed, 90, 120))}
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		pages    []model.Page
+		other    []model.Page
+		expected int
+	}{
+		{"same sequence", pages(1, 2, 3, 4), pages(1, 2, 3, 4), 4},
+		{"credits page added", pages(1, 2, 3, 4), pages(1, 2, 50, 3, 4), 4},
+		{"page dropped", pages(1, 2, 3, 4, 5), pages(1, 2, 4, 5), 4},
+		{"leading pages inserted", pages(1, 2, 3, 4, 5), pages(60, 61, 62, 63, 1, 2, 3, 4, 5), 5},
+		{"pages inserted midway", pages(1, 2, 3, 4, 5, 6), pages(1, 2, 3, 60, 61, 62, 63, 4, 5, 6), 6},
+		{"different issue", pages(1, 2, 3, 4), pages(21, 22, 23, 24), 0},
+		{"reordered far away", pages(1, 2, 3, 4, 5, 6), pages(6, 5, 4, 3, 2, 1), 1},
+		{"empty", nil, pages(1, 2), 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, similarPages(test.pages, test.other))
+		})
+	}
+}
+
+func TestPerceptualIndex(t *testing.T) {
+	const hash = uint64(0x0123456789abcdef)
+
+	index := perceptualIndex{}
+	index.add(1, hash)
+	index.add(2, ^hash)
+
+	tests := []struct {
+		name     string
+		flipped  uint64
+		expected []int
+	}{
+		{"same", 0, []int{1}},
+		{"spread over every band", 0x0003000300030003, []int{1}},
+		{"most allowed", 0x0007000700070001, []int{1}},
+		{"one too many", 0x0007000700070003, nil},
+		{"inverted", ^uint64(0), []int{2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			found := map[int]bool{}
+			index.near(hash^test.flipped, func(owner int) { found[owner] = true })
+
+			var owners []int
+			for owner := range found {
+				owners = append(owners, owner)
+			}
+			assert.Equal(t, test.expected, owners)
+		})
+	}
+}
+
+func TestVisualCandidates(t *testing.T) {
+	item := func(seeds ...int) model.PurgatoryItem {
+		result := model.PurgatoryItem{}
+		for index, seed := range seeds {
+			result.Pages = append(result.Pages, model.Page{Index: index, PerceptualHash: hashOf(drawPage(seed, 90, 120))})
+		}
+		result.CoverHash = result.Pages[0].PerceptualHash
+		return result
+	}
+
+	items := []model.PurgatoryItem{
+		item(1, 2, 3),
+		item(21, 22, 23),
+		// Credits pages in front don't hide the shared ones
+		item(60, 61, 62, 63, 1, 2, 3),
+		{},
+	}
+
+	assert.Equal(t, [][2]int{{0, 2}}, visualCandidates(items))
+}
+
+func TestGroupVisualDuplicates(t *testing.T) {
+	scan := func(id int64, seeds ...int) model.PurgatoryItem {
+		item := model.PurgatoryItem{ID: id}
+		for index, seed := range seeds {
+			item.Pages = append(item.Pages, model.Page{Index: index, PerceptualHash: hashOf(rescan(t, drawPage(seed, 300, 450), 200+int(id)*20, 300+int(id)*30))})
+		}
+		item.CoverHash = item.Pages[0].PerceptualHash
+		return item
+	}
+
+	items := []model.PurgatoryItem{
+		scan(1, 1, 2, 3, 4, 5),
+		scan(2, 11, 12, 13, 14),
+		scan(3, 1, 2, 3, 4, 5),
+		// Same pages as item 1 behind a different cover, like a variant
+		scan(4, 90, 2, 3, 4, 5),
+		scan(5, 11, 12, 13, 14),
+		scan(6, 21, 22, 23),
+	}
+
+	groups := groupVisualDuplicates(items)
+	require.Len(t, groups, 2)
+
+	var pairs [][2]int64
+	for _, match := range groups[0] {
+		pairs = append(pairs, [2]int64{match.ItemID, match.OtherID})
+	}
+	assert.Equal(t, [][2]int64{{1, 3}, {1, 4}, {3, 4}}, pairs)
+
+	require.Len(t, groups[1], 1)
+	assert.Equal(t, int64(2), groups[1][0].ItemID)
+	assert.Equal(t, int64(5), groups[1][0].OtherID)
+	assert.Equal(t, 1.0, groups[1][0].PageSimilarity)
+	assert.LessOrEqual(t, groups[1][0].CoverDistance, maxPerceptualDistance)
+}
@@ -1,102 +1,352 @@
 package service
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"os"
 	"paper/purgatory/dto"
 	"paper/purgatory/model"
+	"paper/purgatory/utils"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"golang.org/x/text/language"
 	"gorm.io/gorm"
 )
 
+const defaultPageSize = 20
+
+// ProgressFunc receives the completion percentage of a long-running operation
+type ProgressFunc func(progress int)
+
+var sortColumns = map[string]string{
+	"id":         "id",
+	"uploadedAt": "uploaded_at",
+	"seriesName": "meta ->> 'seriesName'",
+	"publisher":  "meta ->> 'publisher'",
+	"number":     "substring(meta ->> 'number' from '^[0-9]+(?:[.][0-9]+)?')::numeric",
+}
+
 type purgatoryService struct {
-	database  *gorm.DB
-	filesPath string
+	database       *gorm.DB
+	filesPath      string
+	catalog        CatalogClient
+	thumbnailSizes []int
 }
 
 type PurgatoryService interface {
-	GetAll() *[]model.PurgatoryItem
+	GetAll(filter dto.PurgatoryFilter) (*dto.PurgatoryPage, error)
+
+	Get(id int64) (*dto.PurgatoryItemDetails, error)
 
-	Save(input *os.File, name string) error
+	GetPagePath(id int64, index int) (string, error)
 
-	UploadTempFile(source *multipart.FileHeader) (*os.File, string, error)
+	GetCoverPath(id int64, size int) (string, error)
+
+	Save(input *os.File, name string, created func(id int64), progress ProgressFunc) (*model.PurgatoryItem, error)
+
+	DiscardUnfinished(id int64) error
 
 	SaveMeta(meta dto.NewMeta) *model.PurgatoryItem
+
+	UpdateMeta(id int64, version int64, update func(meta *model.ArchiveMeta) error) (*model.PurgatoryItem, error)
+
+	Approve(id int64, version int64, request dto.ApproveRequest, authorization string) (*model.PurgatoryItem, error)
+
+	Reject(id int64, reason string, username string) (*model.Rejection, error)
+
+	FindDuplicates(id int64) ([]model.DuplicateCandidate, error)
+
+	FindVisualDuplicates(filter dto.VisualDuplicateFilter) (*dto.VisualDuplicatePage, error)
+
+	Delete(id int64) error
 }
 
-func Init(database *gorm.DB, filesPath string) PurgatoryService {
-	return &purgatoryService{database: database, filesPath: filesPath}
+func Init(database *gorm.DB, filesPath string, catalog CatalogClient, thumbnailSizes []int) PurgatoryService {
+	return &purgatoryService{
+		database:       database,
+		filesPath:      filesPath,
+		catalog:        catalog,
+		thumbnailSizes: validThumbnailSizes(thumbnailSizes),
+	}
 }
 
-func (s *purgatoryService) GetAll() *[]model.PurgatoryItem {
-	var items []model.PurgatoryItem
-	s.database.Find(&items)
+func (s *purgatoryService) GetAll(filter dto.PurgatoryFilter) (*dto.PurgatoryPage, error) {
+	if filter.Size == 0 {
+		filter.Size = defaultPageSize
+	}
+
+	query := s.database.Model(&model.PurgatoryItem{})
+	if filter.Status == "" {
+		filter.Status = model.StatusPending
+	}
+	if filter.Status != "all" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.SeriesName != "" {
+		query = query.Where("meta ->> 'seriesName' ilike ?", "%"+escapeLike(normalizeName(filter.SeriesName))+"%")
+	}
+	if filter.Publisher != "" {
+		query = query.Where("meta ->> 'publisher' ilike ?", "%"+escapeLike(filter.Publisher)+"%")
+	}
+	if filter.Number != "" {
+		query = query.Where("meta ->> 'number' = ?", filter.Number)
+	}
+	if !filter.UploadedFrom.IsZero() {
+		query = query.Where("uploaded_at >= ?", filter.UploadedFrom)
+	}
+	if !filter.UploadedTo.IsZero() {
+		// The upper bound is a date, so the whole day is included
+		query = query.Where("uploaded_at < ?", filter.UploadedTo.AddDate(0, 0, 1))
+	}
+	if filter.Overlapping {
+		query = query.Where("overlaps_with is not null")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
 
-	return &items
+	query, err := applySort(query, filter.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []model.PurgatoryItem{}
+	err = query.Offset(filter.Page * filter.Size).Limit(filter.Size).Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.PurgatoryPage{
+		Items: items,
+		Total: total,
+		Page:  filter.Page,
+		Size:  filter.Size,
+	}, nil
 }
 
-func (s *purgatoryService) Save(input *os.File, name string) error {
+func (s *purgatoryService) Get(id int64) (*dto.PurgatoryItemDetails, error) {
+	item, err := s.findItem(id)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.listPageFiles(id)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]dto.PageFile, 0, len(files))
+	for index, file := range files {
+		page, err := readPageFile(index, file)
+		if err != nil {
+			return nil, err
+		}
+		if index < len(item.Pages) {
+			page.Chapter = item.Pages[index].Chapter
+			page.Type = item.Pages[index].Type
+			page.DoublePage = item.Pages[index].DoublePage
+			page.Bookmark = item.Pages[index].Bookmark
+			// Formats Go can't decode, like AVIF, are still known from extraction
+			if page.Format == "" {
+				page.Format = item.Pages[index].Format
+			}
+		}
+		pages = append(pages, page)
+	}
+
+	return &dto.PurgatoryItemDetails{PurgatoryItem: *item, Pages: pages}, nil
+}
+
+func (s *purgatoryService) GetPagePath(id int64, index int) (string, error) {
+	if _, err := s.findItem(id); err != nil {
+		return "", err
+	}
+
+	files, err := s.listPageFiles(id)
+	if err != nil {
+		return "", err
+	}
+
+	if index < 0 || index >= len(files) {
+		return "", ErrPageNotFound
+	}
+
+	return files[index], nil
+}
+
+func (s *purgatoryService) GetCoverPath(id int64, size int) (string, error) {
+	if _, err := s.findItem(id); err != nil {
+		return "", err
+	}
+
+	return s.cachedThumbnail(id, size)
+}
+
+// cachedThumbnail returns the thumbnail closest to the size, generating all of them when it's missing
+func (s *purgatoryService) cachedThumbnail(id int64, size int) (string, error) {
+	path := thumbnailPath(s.thumbnailsPath(id), pickThumbnailSize(s.thumbnailSizes, size))
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	if err := s.generateThumbnails(id); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// Save ingests an uploaded archive. created receives the id of the new item before its pages are
+// extracted, so whoever runs the upload can clean up after a crash.
+func (s *purgatoryService) Save(input *os.File, name string, created func(id int64), progress ProgressFunc) (*model.PurgatoryItem, error) {
 	ext := filepath.Ext(input.Name())
 	var tool ArchiveTool
 	if ext == ".cbr" {
 		tool = NewCbrTool(name)
-	} else if ext == ".cbz" {
+	} else if ext == ".cbz" || ext == ".zip" {
 		tool = NewCbzTool(name)
+	} else if ext == ".cb7" {
+		tool = NewCb7Tool(name)
+	} else if ext == ".cbt" {
+		tool = NewCbtTool(name)
+	} else if ext == ".pdf" {
+		tool = NewPdfTool(name)
+	} else if ext == ".epub" {
+		tool = NewEpubTool(name)
 	} else {
-		return fmt.Errorf("unsupported format")
+		return nil, fmt.Errorf("unsupported format")
 	}
 
 	fileStat, err := input.Stat()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	archiveHash, err := hashReader(io.NewSectionReader(input, 0, fileStat.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash archive: %v", err)
+	}
+
+	// The very same archive uploaded again, like a torrent pack, needs no second extraction
+	existing, err := s.findByArchiveHash(archiveHash)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing, nil
 	}
 
 	meta, err := tool.GetMeta(input, fileStat.Size())
 	if err != nil {
-		return err
+		return nil, err
 	}
+	meta.SeriesName = normalizeName(meta.SeriesName)
+	progress(30)
 
-	existsItem := model.PurgatoryItem{}
-	result := s.database.Where("meta ->> 'seriesName' like ? and meta ->> 'number' = ?", "%"+meta.SeriesName+"%", meta.Number).First(&existsItem)
-	item := model.PurgatoryItem{Meta: meta}
-	if result.Error != nil {
-		s.database.Create(&item)
-	} else {
-		item.ID = existsItem.ID
-		s.database.Save(&item)
+	// Uploads are never merged into existing items, possible duplicates are reported for review instead
+	item := model.PurgatoryItem{
+		Meta:      meta,
+		Status:    model.StatusPending,
+		SeriesKey: seriesKey(meta.SeriesName),
 	}
+	if err := s.database.Create(&item).Error; err != nil {
+		return nil, err
+	}
+	created(item.ID)
 
-	err = tool.Extract(input, filepath.Join(s.filesPath, strconv.FormatInt(item.ID, 10)))
+	// A half extracted item must not linger, let alone be handed out for the next upload of the archive
+	if err := s.extract(&item, tool, input, archiveHash, progress); err != nil {
+		s.discard(item.ID)
+		return nil, err
+	}
+
+	// A missing thumbnail is regenerated on request, so it shouldn't fail the upload
+	if err := s.generateThumbnails(item.ID); err != nil {
+		fmt.Println(err)
+	}
+
+	return &item, nil
+}
+
+// extract unpacks the pages of a created item and completes it. The archive hash is stored only
+// once everything else is, so findByArchiveHash never matches an unfinished item.
+func (s *purgatoryService) extract(item *model.PurgatoryItem, tool ArchiveTool, input *os.File, archiveHash string, progress ProgressFunc) error {
+	pages, err := tool.Extract(input, s.itemPath(item.ID))
 	if err != nil {
 		return err
 	}
+	progress(90)
 
-	return nil
-}
+	// Only now the real page count is known, as non-image entries are dropped on extraction
+	item.Pages = pages
+	item.Chapters = groupChapters(pages)
+	item.Meta.PagesCount = len(pages)
 
-func (s *purgatoryService) UploadTempFile(source *multipart.FileHeader) (*os.File, string, error) {
-	src, err := source.Open()
+	if err := hashPages(s.itemPath(item.ID), item.Pages); err != nil {
+		return err
+	}
+	hashPagesPerceptually(s.itemPath(item.ID), item.Pages)
+	if len(item.Pages) > 0 {
+		item.CoverHash = item.Pages[0].PerceptualHash
+	}
+
+	// Duplicates only inform reviewers, so failing to look them up doesn't fail the upload.
+	// They change as items come and go, so only the overlap flag is kept and FindDuplicates
+	// scores them afresh.
+	item.ArchiveHash = archiveHash
+	duplicates, err := s.findDuplicates(item)
 	if err != nil {
-		return nil, "", err
+		fmt.Println("failed to find duplicates:", err)
 	}
+	item.OverlapsWith = overlappingItem(duplicates)
+
+	return s.database.Transaction(func(tx *gorm.DB) error {
+		err := tx.Select("Meta", "Pages", "Chapters", "ArchiveHash", "OverlapsWith", "CoverHash").Updates(item).Error
+		if err != nil {
+			return err
+		}
 
-	filename := source.Filename
-	destPath := filepath.Join(s.filesPath, filename)
-	dest, err := os.Create(destPath)
+		return storePageHashes(tx, item.ID, item.Pages)
+	})
+}
+
+// discard removes an item whose upload failed, along with whatever was extracted of it
+func (s *purgatoryService) discard(id int64) {
+	err := s.database.Transaction(func(tx *gorm.DB) error {
+		return deleteItem(tx, id)
+	})
 	if err != nil {
-		return nil, "", err
+		fmt.Println("Failed to discard item", id, err)
 	}
 
-	_, err = io.Copy(dest, src)
+	utils.HandleRemove(os.RemoveAll, s.itemPath(id))
+}
+
+// DiscardUnfinished removes an item a crash left half extracted. Finished items stay,
+// a retried upload finds them by the archive hash.
+func (s *purgatoryService) DiscardUnfinished(id int64) error {
+	item, err := s.findItem(id)
+	if errors.Is(err, ErrItemNotFound) {
+		return nil
+	}
 	if err != nil {
-		return nil, "", err
+		return err
 	}
 
-	return dest, destPath, nil
+	if item.ArchiveHash == "" && item.Status == model.StatusPending {
+		s.discard(id)
+	}
+
+	return nil
 }
 
 func (s *purgatoryService) SaveMeta(meta dto.NewMeta) *model.PurgatoryItem {
@@ -106,8 +356,551 @@ func (s *purgatoryService) SaveMeta(meta dto.NewMeta) *model.PurgatoryItem {
 		PagesCount: 0,
 	}
 
-	item := model.PurgatoryItem{Meta: archiveMeta}
+	item := model.PurgatoryItem{Meta: archiveMeta, Status: model.StatusPending, SeriesKey: seriesKey(archiveMeta.SeriesName)}
 	s.database.Create(&item)
 
 	return &item
 }
+
+// UpdateMeta applies the update to the item's meta only if nobody changed the item since the given version
+func (s *purgatoryService) UpdateMeta(id int64, version int64, update func(meta *model.ArchiveMeta) error) (*model.PurgatoryItem, error) {
+	item, err := s.findItem(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Once approval started, the catalog gets the meta it was started with
+	if item.Status != model.StatusPending {
+		return nil, ErrAlreadyApproved
+	}
+
+	if item.Version != version {
+		return nil, ErrVersionMismatch
+	}
+
+	meta := model.ArchiveMeta{}
+	if item.Meta != nil {
+		meta = *item.Meta
+	}
+
+	// The page count is what extraction found, not something to edit
+	pagesCount := meta.PagesCount
+	if err := update(&meta); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMeta, err)
+	}
+	meta.PagesCount = pagesCount
+
+	if err := validateMeta(&meta); err != nil {
+		return nil, err
+	}
+
+	result := s.database.Model(&model.PurgatoryItem{}).
+		Where("id = ? and status = ? and version = ?", id, model.StatusPending, version).
+		Select("Meta", "Version", "SeriesKey").
+		Updates(&model.PurgatoryItem{Meta: &meta, Version: version + 1, SeriesKey: seriesKey(meta.SeriesName)})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, s.conflict(id)
+	}
+
+	item.Meta = &meta
+	item.Version = version + 1
+	item.SeriesKey = seriesKey(meta.SeriesName)
+
+	return item, nil
+}
+
+func (s *purgatoryService) Approve(id int64, version int64, request dto.ApproveRequest, authorization string) (*model.PurgatoryItem, error) {
+	item, err := s.findItem(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if item.Status != model.StatusPending {
+		return nil, ErrAlreadyApproved
+	}
+
+	if item.Version != version {
+		return nil, ErrVersionMismatch
+	}
+
+	pages, err := s.listPageFiles(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.IssueUpdate.PagesCount == 0 {
+		request.IssueUpdate.PagesCount = int32(len(pages))
+	}
+
+	if item.Meta == nil {
+		item.Meta = &model.ArchiveMeta{}
+	}
+
+	if request.SeriesUpdate.Title != "" {
+		item.Meta.SeriesName = request.SeriesUpdate.Title
+	}
+	if request.SeriesUpdate.Publisher != "" {
+		item.Meta.Publisher = request.SeriesUpdate.Publisher
+	}
+	item.Meta.Number = request.IssueUpdate.Number
+	if request.IssueUpdate.Summary != "" {
+		item.Meta.Summary = request.IssueUpdate.Summary
+	}
+	if date := request.IssueUpdate.PublicationDate; !date.IsZero() {
+		item.Meta.Year, item.Meta.Month, item.Meta.Day = date.Year, int(date.Month), date.Day
+	}
+	item.Meta.PagesCount = int(request.IssueUpdate.PagesCount)
+
+	// The item is claimed before the import, so approving it twice can't import it twice
+	if err := s.claimApproval(id, item.Version); err != nil {
+		return nil, err
+	}
+
+	if err := s.catalog.Import(request, pages, authorization); err != nil {
+		s.releaseApproval(id, item.Version)
+		return nil, err
+	}
+
+	item.SeriesKey = seriesKey(item.Meta.SeriesName)
+	item.Status = model.StatusApproved
+	item.Version++
+	err = s.database.Model(&model.PurgatoryItem{}).
+		Where("id = ? and status = ?", id, model.StatusApproving).
+		Select("Meta", "Status", "SeriesKey").
+		Updates(&model.PurgatoryItem{Meta: item.Meta, Status: item.Status, SeriesKey: item.SeriesKey}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Pages are owned by the catalog from now on
+	utils.HandleRemove(os.RemoveAll, s.itemPath(id))
+
+	return item, nil
+}
+
+func (s *purgatoryService) Reject(id int64, reason string, username string) (*model.Rejection, error) {
+	item, err := s.findItem(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if item.Status != model.StatusPending {
+		return nil, ErrAlreadyApproved
+	}
+
+	rejection := model.Rejection{
+		ItemID:     item.ID,
+		Meta:       item.Meta,
+		Reason:     reason,
+		RejectedBy: username,
+	}
+
+	err = s.database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&rejection).Error; err != nil {
+			return err
+		}
+
+		return deleteItem(tx, item.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	utils.HandleRemove(os.RemoveAll, s.itemPath(id))
+
+	return &rejection, nil
+}
+
+// claimApproval moves a pending item of the given version to approving, failing if another
+// request changed or claimed it in between
+func (s *purgatoryService) claimApproval(id int64, version int64) error {
+	result := s.database.Model(&model.PurgatoryItem{}).
+		Where("id = ? and status = ? and version = ?", id, model.StatusPending, version).
+		Select("Status", "Version").
+		Updates(&model.PurgatoryItem{Status: model.StatusApproving, Version: version + 1})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	return s.conflict(id)
+}
+
+// conflict tells why a conditional update of a pending item matched no row
+func (s *purgatoryService) conflict(id int64) error {
+	current, err := s.findItem(id)
+	if err != nil {
+		return err
+	}
+	if current.Status != model.StatusPending {
+		return ErrAlreadyApproved
+	}
+	return ErrVersionMismatch
+}
+
+// releaseApproval puts a claimed item back to pending after the import failed
+func (s *purgatoryService) releaseApproval(id int64, version int64) {
+	err := s.database.Model(&model.PurgatoryItem{}).
+		Where("id = ? and status = ? and version = ?", id, model.StatusApproving, version+1).
+		Select("Status", "Version").
+		Updates(&model.PurgatoryItem{Status: model.StatusPending, Version: version}).Error
+	if err != nil {
+		fmt.Println("Failed to release approval of item", id, err)
+	}
+}
+
+// FindDuplicates scores the items that may hold the same issue, most likely first. Candidates are
+// never stored, as adding, editing or removing any item can change them.
+func (s *purgatoryService) FindDuplicates(id int64) ([]model.DuplicateCandidate, error) {
+	item, err := s.findItem(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.findDuplicates(item)
+}
+
+// FindVisualDuplicates groups the pending items whose covers or page sequences look the same,
+// which byte hashes miss when scan groups compress differently. Groups are paged like GetAll.
+func (s *purgatoryService) FindVisualDuplicates(filter dto.VisualDuplicateFilter) (*dto.VisualDuplicatePage, error) {
+	if filter.Size == 0 {
+		filter.Size = defaultPageSize
+	}
+
+	items, err := s.listPerceptualHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := groupVisualDuplicates(items)
+	total := len(groups)
+	start := min(filter.Page*filter.Size, len(groups))
+	groups = groups[start:min(start+filter.Size, len(groups))]
+
+	summaries, err := s.summarizeItems(groups)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &dto.VisualDuplicatePage{
+		Items: make([]dto.VisualDuplicateGroup, 0, len(groups)),
+		Total: int64(total),
+		Page:  filter.Page,
+		Size:  filter.Size,
+	}
+	for _, matches := range groups {
+		group := dto.VisualDuplicateGroup{Matches: matches}
+		seen := map[int64]bool{}
+		for _, match := range matches {
+			for _, id := range []int64{match.ItemID, match.OtherID} {
+				if !seen[id] {
+					seen[id] = true
+					group.Items = append(group.Items, summaries[id])
+				}
+			}
+		}
+		slices.SortFunc(group.Items, func(a, b dto.VisualDuplicateItem) int {
+			return cmp.Compare(a.ID, b.ID)
+		})
+		page.Items = append(page.Items, group)
+	}
+
+	return page, nil
+}
+
+// listPerceptualHashes loads the pending items with nothing but their cover and page hashes
+func (s *purgatoryService) listPerceptualHashes() ([]model.PurgatoryItem, error) {
+	var rows []struct {
+		ID               int64
+		CoverHash        string
+		PerceptualHashes []string `gorm:"serializer:json"`
+	}
+	err := s.database.Model(&model.PurgatoryItem{}).
+		Select(`id, cover_hash, (select coalesce(jsonb_agg(coalesce(page ->> 'perceptualHash', '') order by position), '[]')
+			from jsonb_array_elements(case when jsonb_typeof(pages) = 'array' then pages else '[]' end)
+			with ordinality as elements(page, position)) as perceptual_hashes`).
+		Where("status = ?", model.StatusPending).
+		Order("id").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]model.PurgatoryItem, len(rows))
+	for index, row := range rows {
+		items[index] = model.PurgatoryItem{ID: row.ID, CoverHash: row.CoverHash, Pages: make([]model.Page, len(row.PerceptualHashes))}
+		for position, hash := range row.PerceptualHashes {
+			items[index].Pages[position] = model.Page{Index: position, PerceptualHash: hash}
+		}
+	}
+
+	return items, nil
+}
+
+// summarizeItems loads the summaries of the items in the groups
+func (s *purgatoryService) summarizeItems(groups [][]dto.VisualMatch) (map[int64]dto.VisualDuplicateItem, error) {
+	var ids []int64
+	for _, matches := range groups {
+		for _, match := range matches {
+			ids = append(ids, match.ItemID, match.OtherID)
+		}
+	}
+
+	summaries := map[int64]dto.VisualDuplicateItem{}
+	if len(ids) == 0 {
+		return summaries, nil
+	}
+
+	var items []model.PurgatoryItem
+	if err := s.database.Select("id", "meta", "uploaded_at").Where("id in ?", ids).Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		summary := dto.VisualDuplicateItem{ID: item.ID, UploadedAt: item.UploadedAt}
+		if item.Meta != nil {
+			summary.SeriesName = item.Meta.SeriesName
+			summary.Number = item.Meta.Number
+			summary.PagesCount = item.Meta.PagesCount
+		}
+		summaries[item.ID] = summary
+	}
+
+	return summaries, nil
+}
+
+func (s *purgatoryService) Delete(id int64) error {
+	item, err := s.findItem(id)
+	if err != nil {
+		return err
+	}
+
+	// The pages of an item being imported are still read by the catalog
+	if item.Status != model.StatusPending {
+		return ErrAlreadyApproved
+	}
+
+	err = s.database.Transaction(func(tx *gorm.DB) error {
+		return deleteItem(tx, item.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	utils.HandleRemove(os.RemoveAll, s.itemPath(id))
+
+	return nil
+}
+
+// deleteItem removes the item row along with its page hashes and the overlap flags pointing at it
+func deleteItem(tx *gorm.DB, id int64) error {
+	if err := tx.Where("item_id = ?", id).Delete(&model.PageHash{}).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Model(&model.PurgatoryItem{}).Where("overlaps_with = ?", id).Update("overlaps_with", nil).Error; err != nil {
+		return err
+	}
+
+	return tx.Delete(&model.PurgatoryItem{}, id).Error
+}
+
+func (s *purgatoryService) findItem(id int64) (*model.PurgatoryItem, error) {
+	item := model.PurgatoryItem{}
+	err := s.database.First(&item, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// findByArchiveHash returns the item uploaded from the same archive, or nil if there is none.
+// Only items whose extraction finished are matched.
+func (s *purgatoryService) findByArchiveHash(hash string) (*model.PurgatoryItem, error) {
+	var items []model.PurgatoryItem
+	err := s.database.Where("archive_hash = ? and jsonb_typeof(pages) = 'array'", hash).Order("id").Limit(1).Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return &items[0], nil
+}
+
+func (s *purgatoryService) listPageFiles(id int64) ([]string, error) {
+	directory := s.itemPath(id)
+	entries, err := os.ReadDir(directory)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		pages = append(pages, filepath.Join(directory, entry.Name()))
+	}
+
+	return pages, nil
+}
+
+func (s *purgatoryService) generateThumbnails(id int64) error {
+	files, err := s.listPageFiles(id)
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return ErrPageNotFound
+	}
+
+	return generateThumbnails(files[0], s.thumbnailsPath(id), s.thumbnailSizes)
+}
+
+func (s *purgatoryService) thumbnailsPath(id int64) string {
+	return filepath.Join(s.itemPath(id), thumbnailsDirectory)
+}
+
+func (s *purgatoryService) itemPath(id int64) string {
+	return filepath.Join(s.filesPath, strconv.FormatInt(id, 10))
+}
+
+func validateMeta(meta *model.ArchiveMeta) error {
+	meta.SeriesName = strings.TrimSpace(normalizeName(meta.SeriesName))
+	meta.Number = strings.TrimSpace(meta.Number)
+	meta.Publisher = strings.TrimSpace(meta.Publisher)
+	meta.Summary = strings.TrimSpace(meta.Summary)
+
+	switch {
+	case meta.SeriesName == "":
+		return fmt.Errorf("%w: series name is required", ErrInvalidMeta)
+	case utf8.RuneCountInString(meta.SeriesName) > 255:
+		return fmt.Errorf("%w: series name is too long", ErrInvalidMeta)
+	case len(meta.Number) > 32:
+		return fmt.Errorf("%w: number is too long", ErrInvalidMeta)
+	case utf8.RuneCountInString(meta.Publisher) > 255:
+		return fmt.Errorf("%w: publisher is too long", ErrInvalidMeta)
+	case meta.PagesCount < 0:
+		return fmt.Errorf("%w: pages count can't be negative", ErrInvalidMeta)
+	}
+
+	return validateComicInfo(meta)
+}
+
+// validateComicInfo checks the ComicInfo fields against the ranges and enumerations of the schema
+func validateComicInfo(meta *model.ArchiveMeta) error {
+	for _, field := range []*string{
+		&meta.Title, &meta.AlternateSeries, &meta.AlternateNumber, &meta.Notes, &meta.Imprint,
+		&meta.LanguageISO, &meta.Format, &meta.AgeRating, &meta.BlackAndWhite, &meta.Manga,
+		&meta.Review, &meta.ScanInformation, &meta.StoryArc, &meta.StoryArcNumber,
+		&meta.SeriesGroup, &meta.GTIN, &meta.MainCharacterOrTeam,
+	} {
+		*field = strings.TrimSpace(*field)
+	}
+
+	for _, list := range []*[]string{
+		&meta.Writer, &meta.Penciller, &meta.Inker, &meta.Colorist, &meta.Letterer, &meta.CoverArtist,
+		&meta.Editor, &meta.Translator, &meta.Genre, &meta.Tags, &meta.Web, &meta.Characters,
+		&meta.Teams, &meta.Locations,
+	} {
+		values := (*list)[:0]
+		for _, value := range *list {
+			value = strings.TrimSpace(value)
+			if utf8.RuneCountInString(value) > 255 {
+				return fmt.Errorf("%w: list value is too long", ErrInvalidMeta)
+			}
+			if value != "" {
+				values = append(values, value)
+			}
+		}
+		*list = values
+	}
+
+	switch {
+	case utf8.RuneCountInString(meta.Title) > 255:
+		return fmt.Errorf("%w: title is too long", ErrInvalidMeta)
+	case meta.Volume < 0 || meta.Count < 0 || meta.AlternateCount < 0:
+		return fmt.Errorf("%w: volume and counts can't be negative", ErrInvalidMeta)
+	case meta.Year < 0 || meta.Year > 9999:
+		return fmt.Errorf("%w: year is out of range", ErrInvalidMeta)
+	case meta.Month < 0 || meta.Month > 12:
+		return fmt.Errorf("%w: month is out of range", ErrInvalidMeta)
+	case meta.Day < 0 || meta.Day > 31:
+		return fmt.Errorf("%w: day is out of range", ErrInvalidMeta)
+	case meta.CommunityRating < 0 || meta.CommunityRating > 5:
+		return fmt.Errorf("%w: community rating must be between 0 and 5", ErrInvalidMeta)
+	case meta.BlackAndWhite != "" && !slices.Contains(yesNoValues, meta.BlackAndWhite):
+		return fmt.Errorf("%w: blackAndWhite must be one of %v", ErrInvalidMeta, yesNoValues)
+	case meta.Manga != "" && !slices.Contains(mangaValues, meta.Manga):
+		return fmt.Errorf("%w: manga must be one of %v", ErrInvalidMeta, mangaValues)
+	case meta.AgeRating != "" && !slices.Contains(ageRatings, meta.AgeRating):
+		return fmt.Errorf("%w: unknown age rating %q", ErrInvalidMeta, meta.AgeRating)
+	case len(meta.LanguageISO) > 35:
+		return fmt.Errorf("%w: language is too long", ErrInvalidMeta)
+	}
+
+	if meta.LanguageISO != "" {
+		if _, err := language.Parse(meta.LanguageISO); err != nil {
+			return fmt.Errorf("%w: %q is not a language code", ErrInvalidMeta, meta.LanguageISO)
+		}
+	}
+
+	if meta.Year > 0 && meta.Month > 0 && meta.Day > 0 {
+		date := time.Date(meta.Year, time.Month(meta.Month), meta.Day, 0, 0, 0, 0, time.UTC)
+		if date.Day() != meta.Day {
+			return fmt.Errorf("%w: %d-%02d-%02d is not a date", ErrInvalidMeta, meta.Year, meta.Month, meta.Day)
+		}
+	}
+
+	if meta.GTIN != "" && !gtinRegex.MatchString(gtinDigits(meta.GTIN)) {
+		return fmt.Errorf("%w: GTIN must have 8, 12, 13 or 14 digits", ErrInvalidMeta)
+	}
+
+	return nil
+}
+
+// applySort orders the query by "field[,asc|desc]" expressions, newest uploads first by default
+func applySort(query *gorm.DB, sort []string) (*gorm.DB, error) {
+	if len(sort) == 0 {
+		sort = []string{"uploadedAt,desc"}
+	}
+
+	for _, expression := range sort {
+		field, direction, _ := strings.Cut(expression, ",")
+		column, ok := sortColumns[field]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidSort, field)
+		}
+
+		direction = strings.ToLower(direction)
+		if direction == "" {
+			direction = "asc"
+		}
+		if direction != "asc" && direction != "desc" {
+			return nil, fmt.Errorf("%w: unknown direction %q", ErrInvalidSort, direction)
+		}
+
+		query = query.Order(column + " " + direction + " nulls last")
+	}
+
+	return query.Order("id desc"), nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
@@ -6,9 +6,6 @@ import (
 	"os"
 	"paper/purgatory/model"
 	"paper/purgatory/utils"
-	"path/filepath"
-	"sort"
-	"strconv"
 	"strings"
 
 	"github.com/nwaples/rardecode/v2"
@@ -35,16 +32,8 @@ func (c *CbrTool) GetMeta(file *os.File, _ int64) (*model.ArchiveMeta, error) {
 		return nil, fmt.Errorf("failed to create RAR reader: %v", err)
 	}
 
-	// Create temp file for XML
-	xmlFile, err := os.CreateTemp("", "ComicInfo_*.xml")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create XML temp file: %v", err)
-	}
-	defer utils.HandleRemove(os.Remove, xmlFile.Name())
-	defer utils.HandleClose(xmlFile.Close)
-
-	var xmlFound bool
 	var descriptors []string
+	var metadataFiles []metadataFile
 
 	for {
 		header, err := rarReader.Next()
@@ -55,56 +44,51 @@ func (c *CbrTool) GetMeta(file *os.File, _ int64) (*model.ArchiveMeta, error) {
 			return nil, fmt.Errorf("failed to read RAR entry: %v", err)
 		}
 
+		if header.IsDir {
+			continue
+		}
+
 		descriptors = append(descriptors, header.Name)
 
-		lowerCaseFileName := strings.ToLower(header.Name)
-		if strings.Contains(lowerCaseFileName, infoFileName) {
-			xmlFound = true
-			if _, err := io.Copy(xmlFile, rarReader); err != nil {
-				return nil, fmt.Errorf("failed to extract XML content: %v", err)
+		if isMetadataFile(header.Name) {
+			metadata, err := readMetadataFile(header.Name, rarReader)
+			if err != nil {
+				return nil, err
 			}
-		} else {
-			io.Copy(io.Discard, rarReader)
+			metadataFiles = append(metadataFiles, metadata)
 		}
 	}
 
-	if xmlFound {
-		meta, err := c.extractMetaFromXml(xmlFile.Name())
-		if err != nil {
-			return nil, err
-		}
-
-		meta.PagesCount = len(descriptors) - 1
-		return meta, nil
+	if len(descriptors) == 0 {
+		return nil, fmt.Errorf("empty archive %v", c.fileName)
 	}
 
-	seriesName := c.resolveSeriesName(descriptors[0])
+	meta, err := c.readMetadata(metadataFiles)
+	if err != nil {
+		return nil, err
+	}
 
-	return &model.ArchiveMeta{
-		SeriesName: seriesName,
-		Number:     c.resolveNumber(seriesName),
-		PagesCount: len(descriptors),
-	}, nil
+	return c.completeMeta(meta, descriptors), nil
 }
 
-func (c *CbrTool) Extract(file *os.File, destination string) error {
+func (c *CbrTool) Extract(file *os.File, destination string) ([]model.Page, error) {
 	// Reset file pointer to beginning
 	if _, err := file.Seek(0, 0); err != nil {
-		return fmt.Errorf("failed to seek file: %v", err)
+		return nil, fmt.Errorf("failed to seek file: %v", err)
 	}
 
 	rarReader, err := rardecode.NewReader(file)
 	if err != nil {
-		return fmt.Errorf("failed to create RAR reader: %v", err)
+		return nil, fmt.Errorf("failed to create RAR reader: %v", err)
 	}
 
 	// Create destination directory
 	if err := os.MkdirAll(destination, 0755); err != nil {
-		return fmt.Errorf("failed to create destination directory: %v", err)
+		return nil, fmt.Errorf("failed to create destination directory: %v", err)
 	}
 
 	// Extract files
-	var extractedFiles []string
+	var extractedFiles []extractedFile
 
 	for {
 		header, err := rarReader.Next()
@@ -112,55 +96,32 @@ func (c *CbrTool) Extract(file *os.File, destination string) error {
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("failed to read RAR entry: %v", err)
+			return nil, fmt.Errorf("failed to read RAR entry: %v", err)
 		}
 
-		// Skip XML files
-		if strings.HasSuffix(strings.ToLower(header.Name), ".xml") {
+		// Skip directories and XML files
+		if header.IsDir || strings.HasSuffix(strings.ToLower(header.Name), ".xml") {
 			io.Copy(io.Discard, rarReader)
 			continue
 		}
 
 		// Create output file
-		outputPath := filepath.Join(destination, filepath.Base(header.Name))
+		outputPath := c.entryPath(destination, len(extractedFiles))
 		outputFile, err := os.Create(outputPath)
 		if err != nil {
-			return fmt.Errorf("failed to create output file %s: %v", outputPath, err)
+			return nil, fmt.Errorf("failed to create output file %s: %v", outputPath, err)
 		}
 
 		// Extract file content
 		if _, err := io.Copy(outputFile, rarReader); err != nil {
-			return fmt.Errorf("failed to extract file %s: %v", header.Name, err)
+			return nil, fmt.Errorf("failed to extract file %s: %v", header.Name, err)
 		}
 
 		utils.HandleClose(outputFile.Close)
 
-		extractedFiles = append(extractedFiles, outputPath)
+		extractedFiles = append(extractedFiles, extractedFile{path: outputPath, name: header.Name})
 	}
 
 	// Rename files to sequential order
-	if len(extractedFiles) > 0 {
-		return renameFiles(destination, extractedFiles)
-	}
-
-	return nil
-}
-
-func renameFiles(destination string, extractedFiles []string) error {
-	sort.Strings(extractedFiles)
-
-	digits := len(strconv.Itoa(len(extractedFiles)))
-
-	for index, oldFile := range extractedFiles {
-		ext := filepath.Ext(oldFile)
-		newFilename := fmt.Sprintf("%0*d%s", digits, index, ext)
-		newPath := filepath.Join(destination, newFilename)
-		oldPath := filepath.Join(oldFile)
-
-		if err := os.Rename(oldPath, newPath); err != nil {
-			return fmt.Errorf("failed to rename file %s to %s: %v", oldPath, newPath, err)
-		}
-	}
-
-	return nil
+	return c.renameFiles(destination, extractedFiles)
 }
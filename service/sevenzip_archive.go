@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"paper/purgatory/model"
+	"paper/purgatory/utils"
+	"strings"
+
+	"github.com/bodgit/sevenzip"
+)
+
+type Cb7Tool struct {
+	baseArchiveTool
+}
+
+func NewCb7Tool(fileName string) *Cb7Tool {
+	return &Cb7Tool{
+		baseArchiveTool: baseArchiveTool{fileName: fileName},
+	}
+}
+
+func (c *Cb7Tool) GetMeta(file *os.File, size int64) (*model.ArchiveMeta, error) {
+	sevenZipReader, err := sevenzip.NewReader(file, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create 7z reader: %v", err)
+	}
+
+	var descriptors []string
+	var metadataFiles []metadataFile
+
+	for _, file := range sevenZipReader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		descriptors = append(descriptors, file.Name)
+
+		if isMetadataFile(file.Name) {
+			metadata, err := c.readMetadataEntry(file)
+			if err != nil {
+				return nil, err
+			}
+			metadataFiles = append(metadataFiles, metadata)
+		}
+	}
+
+	if len(descriptors) == 0 {
+		return nil, fmt.Errorf("empty archive %v", c.fileName)
+	}
+
+	meta, err := c.readMetadata(metadataFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.completeMeta(meta, descriptors), nil
+}
+
+func (c *Cb7Tool) Extract(file *os.File, destination string) ([]model.Page, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %v", err)
+	}
+
+	sevenZipReader, err := sevenzip.NewReader(file, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create 7z reader: %v", err)
+	}
+
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create destination directory: %v", err)
+	}
+
+	var extractedFiles []extractedFile
+	for _, file := range sevenZipReader.File {
+		if file.FileInfo().IsDir() || strings.HasSuffix(strings.ToLower(file.Name), ".xml") {
+			continue
+		}
+
+		outputPath := c.entryPath(destination, len(extractedFiles))
+		outputFile, err := os.Create(outputPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output file %s: %v", outputPath, err)
+		}
+
+		err = c.copyEntry(file, outputFile)
+		utils.HandleClose(outputFile.Close)
+		if err != nil {
+			return nil, err
+		}
+
+		extractedFiles = append(extractedFiles, extractedFile{path: outputPath, name: file.Name})
+	}
+
+	return c.renameFiles(destination, extractedFiles)
+}
+
+func (c *Cb7Tool) readMetadataEntry(file *sevenzip.File) (metadataFile, error) {
+	srcFile, err := file.Open()
+	if err != nil {
+		return metadataFile{}, fmt.Errorf("failed to open file %s: %v", file.Name, err)
+	}
+	defer utils.HandleClose(srcFile.Close)
+
+	return readMetadataFile(file.Name, srcFile)
+}
+
+func (c *Cb7Tool) copyEntry(file *sevenzip.File, destination io.Writer) error {
+	srcFile, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %v", file.Name, err)
+	}
+	defer utils.HandleClose(srcFile.Close)
+
+	if _, err := io.Copy(destination, srcFile); err != nil {
+		return fmt.Errorf("failed to copy file %s: %v", file.Name, err)
+	}
+
+	return nil
+}
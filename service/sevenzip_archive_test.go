@@ -0,0 +1,44 @@
+package service
+
+import (
+	"paper/purgatory/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCb7ToolGetMetaFromComicInfo(t *testing.T) {
+	file, size := openFixture(t, "comicinfo.cb7")
+
+	meta, err := NewCb7Tool("blacksad-3.cb7").GetMeta(file, size)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Blacksad", meta.SeriesName)
+	assert.Equal(t, "3", meta.Number)
+	assert.Equal(t, "Dargaud", meta.Publisher)
+	assert.Equal(t, "A jazz musician dies in New Orleans.", meta.Summary)
+	assert.Equal(t, 3, meta.PagesCount)
+}
+
+func TestCb7ToolGetMetaFromFileName(t *testing.T) {
+	file, size := openFixture(t, "noinfo.cb7")
+
+	meta, err := NewCb7Tool("Usagi Yojimbo 012 (2021).cb7").GetMeta(file, size)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Usagi Yojimbo", meta.SeriesName)
+	assert.Equal(t, "12", meta.Number)
+	assert.Equal(t, 2, meta.PagesCount)
+}
+
+func TestCb7ToolExtract(t *testing.T) {
+	file, _ := openFixture(t, "comicinfo.cb7")
+	destination := t.TempDir()
+
+	pages, err := NewCb7Tool("blacksad-3.cb7").Extract(file, destination)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"0.png", "1.png", "2.png"}, extractedNames(t, destination))
+	assert.Equal(t, model.Page{Index: 2, File: "2.png", Format: "png"}, pages[2])
+}
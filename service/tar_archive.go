@@ -0,0 +1,153 @@
+package service
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"paper/purgatory/model"
+	"paper/purgatory/utils"
+	"strings"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+)
+
+type CbtTool struct {
+	baseArchiveTool
+}
+
+func NewCbtTool(fileName string) *CbtTool {
+	return &CbtTool{
+		baseArchiveTool: baseArchiveTool{fileName: fileName},
+	}
+}
+
+func (c *CbtTool) GetMeta(file *os.File, _ int64) (*model.ArchiveMeta, error) {
+	tarReader, closeReader, err := c.openTar(file)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.HandleClose(closeReader)
+
+	var descriptors []string
+	var metadataFiles []metadataFile
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar entry: %v", err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		descriptors = append(descriptors, header.Name)
+
+		if isMetadataFile(header.Name) {
+			metadata, err := readMetadataFile(header.Name, tarReader)
+			if err != nil {
+				return nil, err
+			}
+			metadataFiles = append(metadataFiles, metadata)
+		}
+	}
+
+	if len(descriptors) == 0 {
+		return nil, fmt.Errorf("empty archive %v", c.fileName)
+	}
+
+	meta, err := c.readMetadata(metadataFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.completeMeta(meta, descriptors), nil
+}
+
+func (c *CbtTool) Extract(file *os.File, destination string) ([]model.Page, error) {
+	tarReader, closeReader, err := c.openTar(file)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.HandleClose(closeReader)
+
+	// Create destination directory
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create destination directory: %v", err)
+	}
+
+	var extractedFiles []extractedFile
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar entry: %v", err)
+		}
+
+		// Skip directories, links and XML files
+		if header.Typeflag != tar.TypeReg || strings.HasSuffix(strings.ToLower(header.Name), ".xml") {
+			continue
+		}
+
+		outputPath := c.entryPath(destination, len(extractedFiles))
+		outputFile, err := os.Create(outputPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output file %s: %v", outputPath, err)
+		}
+
+		if _, err := io.Copy(outputFile, tarReader); err != nil {
+			utils.HandleClose(outputFile.Close)
+			return nil, fmt.Errorf("failed to extract file %s: %v", header.Name, err)
+		}
+
+		utils.HandleClose(outputFile.Close)
+
+		extractedFiles = append(extractedFiles, extractedFile{path: outputPath, name: header.Name})
+	}
+
+	// Rename files to sequential order
+	return c.renameFiles(destination, extractedFiles)
+}
+
+// openTar detects gzip and bzip2 compression by magic bytes, so .cbt files may hold any tarball flavour
+func (c *CbtTool) openTar(file *os.File) (*tar.Reader, func() error, error) {
+	// Reset file pointer to beginning
+	if _, err := file.Seek(0, 0); err != nil {
+		return nil, nil, fmt.Errorf("failed to seek file: %v", err)
+	}
+
+	reader := bufio.NewReader(file)
+	magic, err := reader.Peek(3)
+	if err != nil && err != io.EOF {
+		return nil, nil, fmt.Errorf("failed to read archive header: %v", err)
+	}
+
+	noop := func() error { return nil }
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create gzip reader: %v", err)
+		}
+		return tar.NewReader(gzipReader), gzipReader.Close, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return tar.NewReader(bzip2.NewReader(reader)), noop, nil
+	default:
+		return tar.NewReader(reader), noop, nil
+	}
+}
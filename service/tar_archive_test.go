@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var tarFixtures = []string{"plain.cbt", "gzip.cbt", "bzip2.cbt"}
+
+func TestCbtToolGetMeta(t *testing.T) {
+	for _, fixture := range tarFixtures {
+		t.Run(fixture, func(t *testing.T) {
+			file, size := openFixture(t, fixture)
+
+			meta, err := NewCbtTool("bone-07.cbt").GetMeta(file, size)
+			require.NoError(t, err)
+
+			assert.Equal(t, "Bone", meta.SeriesName)
+			assert.Equal(t, "7", meta.Number)
+			assert.Equal(t, "Cartoon Books", meta.Publisher)
+			assert.Equal(t, 2, meta.PagesCount)
+		})
+	}
+}
+
+func TestCbtToolExtract(t *testing.T) {
+	for _, fixture := range tarFixtures {
+		t.Run(fixture, func(t *testing.T) {
+			file, _ := openFixture(t, fixture)
+			destination := t.TempDir()
+
+			pages, err := NewCbtTool("bone-07.cbt").Extract(file, destination)
+			require.NoError(t, err)
+
+			assert.Equal(t, []string{"0.png", "1.png"}, extractedNames(t, destination))
+			assert.Len(t, pages, 2)
+		})
+	}
+}
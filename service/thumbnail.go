@@ -0,0 +1,104 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"paper/purgatory/utils"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+const thumbnailsDirectory = "thumbnails"
+
+// DefaultThumbnailSizes are the widths covers are scaled to when none are configured
+var DefaultThumbnailSizes = []int{150, 300, 600}
+
+// validThumbnailSizes drops the sizes no thumbnail can be scaled to, falling back to the
+// defaults when none are left
+func validThumbnailSizes(sizes []int) []int {
+	valid := make([]int, 0, len(sizes))
+	for _, size := range sizes {
+		if size > 0 && !slices.Contains(valid, size) {
+			valid = append(valid, size)
+		}
+	}
+
+	if len(valid) == 0 {
+		return slices.Clone(DefaultThumbnailSizes)
+	}
+	return valid
+}
+
+// generateThumbnails scales the source page down to every configured width, keeping the aspect ratio
+func generateThumbnails(source string, destination string, sizes []int) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("failed to open cover %s: %v", source, err)
+	}
+	defer utils.HandleClose(file.Close)
+
+	cover, _, err := image.Decode(file)
+	if err != nil {
+		return fmt.Errorf("failed to decode cover %s: %v", source, err)
+	}
+
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return fmt.Errorf("failed to create thumbnails directory: %v", err)
+	}
+
+	for _, size := range sizes {
+		if err := writeThumbnail(cover, thumbnailPath(destination, size), size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeThumbnail(cover image.Image, path string, width int) error {
+	bounds := cover.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return fmt.Errorf("cover has no pixels")
+	}
+
+	// Covers are never upscaled
+	width = min(width, bounds.Dx())
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+
+	thumbnail := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), cover, bounds, draw.Src, nil)
+
+	output, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create thumbnail %s: %v", path, err)
+	}
+	defer utils.HandleClose(output.Close)
+
+	if err := jpeg.Encode(output, thumbnail, &jpeg.Options{Quality: 85}); err != nil {
+		return fmt.Errorf("failed to encode thumbnail %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// pickThumbnailSize returns the smallest configured size that covers the requested one.
+// The sizes must not be empty, which Init ensures.
+func pickThumbnailSize(sizes []int, requested int) int {
+	sorted := slices.Sorted(slices.Values(sizes))
+	for _, size := range sorted {
+		if size >= requested {
+			return size
+		}
+	}
+
+	return sorted[len(sorted)-1]
+}
+
+func thumbnailPath(destination string, size int) string {
+	return filepath.Join(destination, strconv.Itoa(size)+".jpg")
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidThumbnailSizes(t *testing.T) {
+	tests := []struct {
+		name     string
+		sizes    []int
+		expected []int
+	}{
+		{"configured", []int{300, 150}, []int{300, 150}},
+		{"non-positive dropped", []int{0, 150, -300}, []int{150}},
+		{"repeated dropped", []int{150, 150}, []int{150}},
+		{"none left", []int{0, -1}, DefaultThumbnailSizes},
+		{"empty", nil, DefaultThumbnailSizes},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, validThumbnailSizes(test.sizes))
+		})
+	}
+}
+
+func TestPickThumbnailSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		sizes     []int
+		requested int
+		expected  int
+	}{
+		{"exact", []int{150, 300, 600}, 300, 300},
+		{"rounded up", []int{150, 300, 600}, 200, 300},
+		{"unsorted", []int{600, 150, 300}, 200, 300},
+		{"larger than all", []int{150, 300, 600}, 1000, 600},
+		{"zero", []int{150, 300, 600}, 0, 150},
+		{"negative", []int{150, 300, 600}, -1, 150},
+		{"single", []int{300}, 100, 300},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, pickThumbnailSize(test.sizes, test.requested))
+		})
+	}
+}
+
+func TestCachedThumbnail(t *testing.T) {
+	service := &purgatoryService{filesPath: t.TempDir(), thumbnailSizes: []int{40, 80}}
+	require.NoError(t, os.MkdirAll(service.itemPath(1), 0755))
+
+	var buffer bytes.Buffer
+	require.NoError(t, png.Encode(&buffer, drawPage(1, 90, 120)))
+	require.NoError(t, os.WriteFile(filepath.Join(service.itemPath(1), "0.png"), buffer.Bytes(), 0644))
+
+	// A miss generates every size
+	path, err := service.cachedThumbnail(1, 50)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(service.thumbnailsPath(1), "80.jpg"), path)
+	assert.FileExists(t, filepath.Join(service.thumbnailsPath(1), "40.jpg"))
+
+	// A hit returns the file as it is
+	stale := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(path, stale, stale))
+
+	path, err = service.cachedThumbnail(1, 80)
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(stale))
+
+	// Without pages there is nothing to generate from
+	_, err = service.cachedThumbnail(2, 50)
+	assert.ErrorIs(t, err, ErrPageNotFound)
+}
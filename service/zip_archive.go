@@ -7,9 +7,6 @@ import (
 	"os"
 	"paper/purgatory/model"
 	"paper/purgatory/utils"
-	"path/filepath"
-	"sort"
-	"strconv"
 	"strings"
 )
 
@@ -29,16 +26,8 @@ func (c *CbzTool) GetMeta(file *os.File, size int64) (*model.ArchiveMeta, error)
 		return nil, fmt.Errorf("failed to create zip reader: %v", err)
 	}
 
-	xmlFile, err := os.CreateTemp("", "ComicInfo_*.xml")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create temp file: %v", err)
-	}
-
-	defer utils.HandleRemove(os.Remove, xmlFile.Name())
-	defer utils.HandleClose(xmlFile.Close)
-
 	var descriptors []string
-	var xmlFound bool
+	var metadataFiles []metadataFile
 
 	for _, file := range zipReader.File {
 		if file.FileInfo().IsDir() {
@@ -47,18 +36,12 @@ func (c *CbzTool) GetMeta(file *os.File, size int64) (*model.ArchiveMeta, error)
 
 		descriptors = append(descriptors, file.Name)
 
-		lowerCaseFileName := strings.ToLower(file.Name)
-		if !xmlFound && strings.Contains(lowerCaseFileName, infoFileName) {
-			xmlFound = true
-			srcFile, err := file.Open()
+		if isMetadataFile(file.Name) {
+			metadata, err := c.readMetadataEntry(file)
 			if err != nil {
-				return nil, fmt.Errorf("failed to open XML file: %v", err)
-			}
-			defer utils.HandleClose(srcFile.Close)
-
-			if _, err := io.Copy(xmlFile, srcFile); err != nil {
-				xmlFound = false
+				return nil, err
 			}
+			metadataFiles = append(metadataFiles, metadata)
 		}
 	}
 
@@ -66,103 +49,89 @@ func (c *CbzTool) GetMeta(file *os.File, size int64) (*model.ArchiveMeta, error)
 		return nil, fmt.Errorf("empty archive %v", c.fileName)
 	}
 
-	if xmlFound {
-		meta, err := c.extractMetaFromXml(xmlFile.Name())
-		if err != nil {
-			return nil, err
+	meta, err := c.readMetadata(metadataFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	// Metadata files take precedence, the ComicBookInfo comment only fills their gaps
+	if bookInfo, found := parseComicBookInfo(zipReader.Comment); found {
+		if meta == nil {
+			meta = c.bookInfoMeta(bookInfo)
+		} else {
+			mergeMeta(meta, c.bookInfoMeta(bookInfo))
 		}
+	}
+
+	return c.completeMeta(meta, descriptors), nil
+}
 
-		meta.PagesCount = len(descriptors) - 1
-		return meta, nil
+func (c *CbzTool) readMetadataEntry(file *zip.File) (metadataFile, error) {
+	srcFile, err := file.Open()
+	if err != nil {
+		return metadataFile{}, fmt.Errorf("failed to open file %s: %v", file.Name, err)
 	}
+	defer utils.HandleClose(srcFile.Close)
 
-	seriesName := c.resolveSeriesName(descriptors[0])
+	return readMetadataFile(file.Name, srcFile)
+}
 
-	return &model.ArchiveMeta{
-		SeriesName: seriesName,
-		Number:     c.resolveNumber(seriesName),
-		PagesCount: len(descriptors),
-	}, nil
+func (c *CbzTool) bookInfoMeta(bookInfo *comicBookInfo) *model.ArchiveMeta {
+	meta := bookInfo.meta()
+	if meta.Number != "" {
+		meta.Number = c.normalizeNumber(meta.Number)
+	}
+	return meta
 }
 
-func (c *CbzTool) Extract(file *os.File, destination string) error {
+func (c *CbzTool) Extract(file *os.File, destination string) ([]model.Page, error) {
 	info, err := file.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to get file info: %v", err)
+		return nil, fmt.Errorf("failed to get file info: %v", err)
 	}
 
 	size := info.Size()
 	zipReader, err := zip.NewReader(file, size)
 	if err != nil {
-		return fmt.Errorf("failed to create zip reader: %v", err)
+		return nil, fmt.Errorf("failed to create zip reader: %v", err)
 	}
 
 	if err := os.MkdirAll(destination, 0755); err != nil {
-		return fmt.Errorf("failed to create destination directory: %v", err)
+		return nil, fmt.Errorf("failed to create destination directory: %v", err)
 	}
 
-	var imageFiles []string
+	var extractedFiles []extractedFile
 	for _, file := range zipReader.File {
 		if file.FileInfo().IsDir() || strings.HasSuffix(strings.ToLower(file.Name), ".xml") {
 			continue
 		}
 
-		srcFile, err := file.Open()
-		if err != nil {
-			return fmt.Errorf("failed to open file %s: %v", file.Name, err)
-		}
-		defer utils.HandleClose(srcFile.Close)
-
-		// Use original filename temporarily
-		tempFilename := filepath.Base(file.Name)
-		tempPath := filepath.Join(destination, tempFilename)
-
-		dstFile, err := os.Create(tempPath)
-		if err != nil {
-			return fmt.Errorf("failed to create file %s: %v", tempPath, err)
+		outputPath := c.entryPath(destination, len(extractedFiles))
+		if err := c.extractFile(file, outputPath); err != nil {
+			return nil, err
 		}
 
-		defer utils.HandleClose(dstFile.Close)
+		extractedFiles = append(extractedFiles, extractedFile{path: outputPath, name: file.Name})
+	}
 
-		if _, err := io.Copy(dstFile, srcFile); err != nil {
-			return fmt.Errorf("failed to copy file %s: %v", file.Name, err)
-		}
+	return c.renameFiles(destination, extractedFiles)
+}
 
-		imageFiles = append(imageFiles, tempFilename)
+func (c *CbzTool) extractFile(file *zip.File, outputPath string) error {
+	srcFile, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %v", file.Name, err)
 	}
+	defer utils.HandleClose(srcFile.Close)
 
-	// Sort files by name length then alphabetically
-	sort.Slice(imageFiles, func(i, j int) bool {
-		if len(imageFiles[i]) != len(imageFiles[j]) {
-			return len(imageFiles[i]) < len(imageFiles[j])
-		}
-		return imageFiles[i] < imageFiles[j]
-	})
-
-	// Calculate digits needed for padding
-	digits := len(strconv.Itoa(len(imageFiles)))
-
-	// Second pass: rename files to sequential names
-	for index, oldFilename := range imageFiles {
-		oldPath := filepath.Join(destination, oldFilename)
-		newFilename := fmt.Sprintf("%0*d.jpg", digits, index)
-		newPath := filepath.Join(destination, newFilename)
-
-		// Read the old file
-		content, err := os.ReadFile(oldPath)
-		if err != nil {
-			return fmt.Errorf("failed to read file %s: %v", oldPath, err)
-		}
-
-		// Write to new file
-		if err := os.WriteFile(newPath, content, 0644); err != nil {
-			return fmt.Errorf("failed to write file %s: %v", newPath, err)
-		}
+	dstFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %v", outputPath, err)
+	}
+	defer utils.HandleClose(dstFile.Close)
 
-		// Remove old file
-		if err := os.Remove(oldPath); err != nil {
-			return fmt.Errorf("failed to remove old file %s: %v", oldPath, err)
-		}
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		return fmt.Errorf("failed to copy file %s: %v", file.Name, err)
 	}
 
 	return nil
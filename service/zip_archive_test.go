@@ -0,0 +1,239 @@
+package service
+
+import (
+	"archive/zip"
+	"os"
+	"paper/purgatory/model"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const jpegSignature = "\xff\xd8\xff\xe0"
+
+// writeZip creates an archive with the given name/content entries in the given order
+func writeZip(t *testing.T, entries [][2]string) *os.File {
+	return writeZipWithComment(t, entries, "")
+}
+
+func writeZipWithComment(t *testing.T, entries [][2]string, comment string) *os.File {
+	path := filepath.Join(t.TempDir(), "test.cbz")
+	output, err := os.Create(path)
+	require.NoError(t, err)
+
+	writer := zip.NewWriter(output)
+	require.NoError(t, writer.SetComment(comment))
+	for _, entry := range entries {
+		part, err := writer.Create(entry[0])
+		require.NoError(t, err)
+		_, err = part.Write([]byte(entry[1]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	require.NoError(t, output.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = file.Close() })
+
+	return file
+}
+
+func TestCbzToolExtractKeepsImageFormats(t *testing.T) {
+	file := writeZip(t, [][2]string{
+		{"page2.jpg", pngSignature},
+		{"page10.jpg", jpegSignature},
+		{"page1.jpg", "RIFF\x00\x00\x00\x00WEBPVP8 "},
+		{"Thumbs.db", "not an image"},
+	})
+	destination := t.TempDir()
+
+	pages, err := NewCbzTool("mixed.cbz").Extract(file, destination)
+	require.NoError(t, err)
+
+	var formats []string
+	for _, page := range pages {
+		formats = append(formats, page.File+":"+page.Format)
+	}
+	assert.Equal(t, []string{"0.webp:webp", "1.png:png", "2.jpg:jpeg"}, formats)
+
+	extracted, err := os.ReadDir(destination)
+	require.NoError(t, err)
+	assert.Len(t, extracted, 3)
+}
+
+func TestCbzToolExtractKeepsChapters(t *testing.T) {
+	entries := [][2]string{
+		{"Berserk v01/Chapter 2/01.jpg", jpegSignature + "c2p1"},
+		{"Berserk v01/Chapter 1/02.jpg", jpegSignature + "c1p2"},
+		{"Berserk v01/Chapter 10/01.jpg", jpegSignature + "c10p1"},
+		{"Berserk v01/cover.jpg", jpegSignature + "cover"},
+		{"Berserk v01/Chapter 1/01.jpg", jpegSignature + "c1p1"},
+	}
+	file := writeZip(t, entries)
+	destination := t.TempDir()
+
+	pages, err := NewCbzTool("Berserk v01.cbz").Extract(file, destination)
+	require.NoError(t, err)
+
+	expected := []struct{ content, chapter string }{
+		{"cover", ""},
+		{"c1p1", "Chapter 1"},
+		{"c1p2", "Chapter 1"},
+		{"c2p1", "Chapter 2"},
+		{"c10p1", "Chapter 10"},
+	}
+	require.Len(t, pages, len(expected))
+	for index, page := range pages {
+		content, err := os.ReadFile(filepath.Join(destination, page.File))
+		require.NoError(t, err)
+		assert.Equal(t, jpegSignature+expected[index].content, string(content))
+		assert.Equal(t, expected[index].chapter, page.Chapter)
+	}
+
+	assert.Equal(t, []model.Chapter{
+		{Title: "Chapter 1", FirstPage: 1, PagesCount: 2},
+		{Title: "Chapter 2", FirstPage: 3, PagesCount: 1},
+		{Title: "Chapter 10", FirstPage: 4, PagesCount: 1},
+	}, groupChapters(pages))
+}
+
+func TestCbzToolHonorsComicInfoPages(t *testing.T) {
+	comicInfo := `<ComicInfo>
+  <Series>Saga</Series>
+  <Number>54</Number>
+  <Pages>
+    <Page Image="0" Type="FrontCover" ImageWidth="1988" ImageHeight="3056" />
+    <Page Image="1" Type="Advertisement" />
+    <Page Image="2" Type="Deleted" />
+    <Page Image="3" Type="Story" DoublePage="True" Bookmark="Chapter 1" />
+  </Pages>
+</ComicInfo>`
+	file := writeZip(t, [][2]string{
+		{"ComicInfo.xml", comicInfo},
+		{"03.jpg", jpegSignature + "story"},
+		{"00.jpg", jpegSignature + "cover"},
+		{"notes.txt", "scanned by nobody"},
+		{"02.jpg", jpegSignature + "scanner credits"},
+		{"01.jpg", jpegSignature + "ad"},
+	})
+	info, err := file.Stat()
+	require.NoError(t, err)
+
+	tool := NewCbzTool("saga-54.cbz")
+	meta, err := tool.GetMeta(file, info.Size())
+	require.NoError(t, err)
+	assert.Equal(t, 3, meta.PagesCount)
+
+	destination := t.TempDir()
+	pages, err := tool.Extract(file, destination)
+	require.NoError(t, err)
+
+	assert.Equal(t, []model.Page{
+		{Index: 0, File: "0.jpg", Format: "jpeg", Type: model.PageTypeFrontCover, Width: 1988, Height: 3056},
+		{Index: 1, File: "1.jpg", Format: "jpeg", Type: model.PageTypeAdvertisement},
+		{Index: 2, File: "2.jpg", Format: "jpeg", Type: model.PageTypeStory, DoublePage: true, Bookmark: "Chapter 1"},
+	}, pages)
+
+	content, err := os.ReadFile(filepath.Join(destination, "2.jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, jpegSignature+"story", string(content))
+
+	extracted, err := os.ReadDir(destination)
+	require.NoError(t, err)
+	assert.Len(t, extracted, 3)
+}
+
+const comicBookInfoComment = `{
+  "appID": "ComicTagger/1.5.5",
+  "lastModified": "2023-04-02 10:12:00",
+  "ComicBookInfo/1.0": {
+    "series": "Saga",
+    "title": "Chapter Fifty-Four",
+    "publisher": "Image Comics",
+    "publicationMonth": 7,
+    "publicationYear": 2018,
+    "issue": 54,
+    "numberOfIssues": 66,
+    "volume": 2012,
+    "genre": "Science Fiction, Fantasy",
+    "language": "English",
+    "rating": 5,
+    "credits": [
+      {"person": "Brian K. Vaughan", "role": "Writer", "primary": true},
+      {"person": "Fiona Staples", "role": "Artist"},
+      {"person": "Fonografiks", "role": "Letterer"}
+    ],
+    "tags": ["space opera", " "],
+    "comments": "Hazel goes to school."
+  }
+}`
+
+func TestCbzToolGetMetaFromComicBookInfo(t *testing.T) {
+	file := writeZipWithComment(t, [][2]string{
+		{"saga-54-01.jpg", jpegSignature},
+		{"saga-54-02.jpg", jpegSignature},
+	}, comicBookInfoComment)
+	info, err := file.Stat()
+	require.NoError(t, err)
+
+	meta, err := NewCbzTool("saga-54.cbz").GetMeta(file, info.Size())
+	require.NoError(t, err)
+
+	assert.Equal(t, &model.ArchiveMeta{
+		SeriesName:      "Saga",
+		Number:          "54",
+		Summary:         "Hazel goes to school.",
+		Publisher:       "Image Comics",
+		PagesCount:      2,
+		Title:           "Chapter Fifty-Four",
+		Volume:          2012,
+		Count:           66,
+		Year:            2018,
+		Month:           7,
+		Writer:          []string{"Brian K. Vaughan"},
+		Penciller:       []string{"Fiona Staples"},
+		Inker:           []string{"Fiona Staples"},
+		Letterer:        []string{"Fonografiks"},
+		Genre:           []string{"Science Fiction", "Fantasy"},
+		Tags:            []string{"space opera"},
+		CommunityRating: 5,
+	}, meta)
+}
+
+func TestCbzToolPrefersComicInfoOverComicBookInfo(t *testing.T) {
+	comicInfo := `<ComicInfo>
+  <Series>Saga (2012)</Series>
+  <Number>54</Number>
+  <Publisher>Image</Publisher>
+  <Writer>Brian K. Vaughan</Writer>
+</ComicInfo>`
+	file := writeZipWithComment(t, [][2]string{
+		{"ComicInfo.xml", comicInfo},
+		{"saga-54-01.jpg", jpegSignature},
+	}, comicBookInfoComment)
+	info, err := file.Stat()
+	require.NoError(t, err)
+
+	meta, err := NewCbzTool("saga-54.cbz").GetMeta(file, info.Size())
+	require.NoError(t, err)
+
+	// Fields ComicInfo sets win
+	assert.Equal(t, "Saga (2012)", meta.SeriesName)
+	assert.Equal(t, "Image", meta.Publisher)
+	assert.Equal(t, []string{"Brian K. Vaughan"}, meta.Writer)
+	// Missing ones come from the comment
+	assert.Equal(t, "Hazel goes to school.", meta.Summary)
+	assert.Equal(t, []string{"Fiona Staples"}, meta.Penciller)
+	assert.Equal(t, 2018, meta.Year)
+	assert.Equal(t, 1, meta.PagesCount)
+}
+
+func TestParseComicBookInfoIgnoresOtherComments(t *testing.T) {
+	for _, comment := range []string{"", "Scanned by nobody", `{"ComicBookInfo/1.0": "broken"`} {
+		_, found := parseComicBookInfo(comment)
+		assert.False(t, found, comment)
+	}
+}